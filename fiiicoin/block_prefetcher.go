@@ -0,0 +1,121 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+//blockFetchResult 获取的区块，hashErr为获取区块hash的错误，blockErr为获取区块数据的错误
+type blockFetchResult struct {
+	height   uint64
+	hash     string
+	block    *Block
+	hashErr  error
+	blockErr error
+}
+
+/*
+blockPrefetcher 追块时并发预取后续的size个区块，按高度顺序取出。
+
+扫描器处理完一个区块（提取交易单、通知观测者）后才取下一个区块，观测者处理慢时扫描器取得慢，
+预取队列满了就不再发起请求，同时请求和缓存的区块最多size个。
+取出的高度不连续（分叉回退、跳过区块）或超过预取范围时，丢弃已预取的区块，从新的高度重新预取。
+*/
+type blockPrefetcher struct {
+	wm      *WalletManager
+	size    int
+	next    uint64 //下一个取出的高度
+	to      uint64 //预取的最大高度
+	results chan chan *blockFetchResult
+	quit    chan struct{}
+}
+
+//newBlockPrefetcher 创建区块预取器，size不大于1时不预取，每次直接请求节点
+func newBlockPrefetcher(wm *WalletManager, size int) *blockPrefetcher {
+	return &blockPrefetcher{
+		wm:   wm,
+		size: size,
+	}
+}
+
+//Fetch 获取height的区块，最多预取到maxHeight
+func (p *blockPrefetcher) Fetch(height, maxHeight uint64) *blockFetchResult {
+
+	if p.size <= 1 || height >= maxHeight {
+		p.Stop()
+		return p.fetch(height)
+	}
+
+	if p.results == nil || height != p.next || height > p.to {
+		p.Stop()
+		p.start(height, maxHeight)
+	}
+
+	future := <-p.results
+	p.next = height + 1
+	return <-future
+}
+
+//Stop 停止预取，已发出的请求完成后丢弃
+func (p *blockPrefetcher) Stop() {
+	if p.quit != nil {
+		close(p.quit)
+	}
+	p.quit = nil
+	p.results = nil
+}
+
+//start 从from开始按顺序发起请求，队列满时等待取出
+func (p *blockPrefetcher) start(from, to uint64) {
+
+	var (
+		results = make(chan chan *blockFetchResult, p.size-1)
+		quit    = make(chan struct{})
+	)
+
+	p.next = from
+	p.to = to
+	p.results = results
+	p.quit = quit
+
+	p.wm.Log.Std.Info("block scanner prefetching blocks from height: %d to %d, size: %d", from, to, p.size)
+
+	go func() {
+		for height := from; height <= to; height++ {
+			future := make(chan *blockFetchResult, 1)
+			select {
+			case results <- future:
+			case <-quit:
+				return
+			}
+			go func(h uint64) {
+				future <- p.fetch(h)
+			}(height)
+		}
+	}()
+}
+
+//fetch 请求节点获取区块
+func (p *blockPrefetcher) fetch(height uint64) *blockFetchResult {
+
+	result := &blockFetchResult{height: height}
+
+	result.hash, result.hashErr = p.wm.GetBlockHash(height)
+	if result.hashErr != nil {
+		return result
+	}
+
+	result.block, result.blockErr = p.wm.GetBlock(result.hash)
+
+	return result
+}
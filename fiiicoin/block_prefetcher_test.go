@@ -0,0 +1,102 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBlockPrefetcher_Fetch(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 20; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	//统计GetBlock请求数
+	var requests int64
+	node.SetHandler("GetBlock", func(params []gjson.Result) (interface{}, error) {
+		atomic.AddInt64(&requests, 1)
+		return node.getBlock(params)
+	})
+
+	wm := testMockWalletManager(node)
+	prefetcher := newBlockPrefetcher(wm, 5)
+	defer prefetcher.Stop()
+
+	check := func(height uint64) {
+		fetched := prefetcher.Fetch(height, 20)
+		if fetched.hashErr != nil || fetched.blockErr != nil || fetched.block.Height != height || fetched.hash != node.blocks[height].Header.Hash {
+			t.Errorf("fetch height: %d got: %+v", height, fetched)
+		}
+	}
+
+	//观测者未处理时，请求数不超过预取数量
+	check(1)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt64(&requests); n > 6 {
+		t.Errorf("GetBlock requests: %d, should not be more than 6", n)
+	}
+
+	for height := uint64(2); height <= 10; height++ {
+		check(height)
+	}
+
+	//高度不连续时重新预取
+	check(4)
+	check(5)
+	for height := uint64(12); height <= 20; height++ {
+		check(height)
+	}
+}
+
+func TestFIIIBlockScanner_Prefetch(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 12; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, observer := testMockScanner(node, dir)
+	bs.PrefetchBlocks = 4
+	bs.ScanBlockTask()
+
+	//按高度顺序通知
+	headers := observer.wait(11)
+	if len(headers) != 11 {
+		t.Errorf("new block notifications: %d, want 11", len(headers))
+		return
+	}
+	for i, header := range headers {
+		if header.Height != uint64(i+2) || header.Hash != node.blocks[i+2].Header.Hash {
+			t.Errorf("notification[%d] should be block: %d, got: %+v", i, i+2, header)
+		}
+	}
+}
@@ -2,9 +2,35 @@ package fiiicoin
 
 import (
 	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
 	"github.com/blocktree/openwallet/openwallet"
+	"path/filepath"
+	"sort"
 )
 
+const (
+	//默认本地保存交易单列表的区块数量
+	defaultBlockTxsCacheSize = 1000
+)
+
+//LocalBlockTxs 本地保存的区块交易单，按区块hash保存，分叉的区块也会保留到被清理
+type LocalBlockTxs struct {
+	Hash              string `storm:"id"`
+	Height            uint64 `storm:"index"`
+	Previousblockhash string
+	Version           uint64
+	Time              uint64
+	TxIDs             []string            //区块中的所有交易单
+	RelevantTxs       map[string][]string //与钱包相关的交易单: sourceKey
+}
+
+//LocalAddressUsage 钱包地址的使用记录，扫描到地址的输入输出后保存，不会删除
+type LocalAddressUsage struct {
+	Address string `storm:"id"`
+	TxID    string //最近一次使用的交易单
+}
+
 //SaveLocalBlockHead 记录区块高度和hash到本地
 func (bs *FIIIBlockScanner) SaveLocalBlockHead(blockHeight uint64, blockHash string) error {
 
@@ -53,7 +79,13 @@ func (bs *FIIIBlockScanner) SaveLocalBlock(blockHeader *Block) error {
 		Symbol:            bs.wm.Symbol(),
 	}
 
-	return bs.BlockchainDAI.SaveLocalBlockHead(header)
+	err := bs.BlockchainDAI.SaveLocalBlockHead(header)
+	if err != nil {
+		return err
+	}
+
+	//保存区块的交易单列表
+	return bs.saveLocalBlockTxs(blockHeader)
 }
 
 //GetLocalBlock 获取本地区块数据
@@ -69,8 +101,18 @@ func (bs *FIIIBlockScanner) GetLocalBlock(height uint64) (*Block, error) {
 	}
 
 	block := &Block{
-		Hash:   header.Hash,
-		Height: header.Height,
+		Hash:              header.Hash,
+		Height:            header.Height,
+		Previousblockhash: header.Previousblockhash,
+		Merkleroot:        header.Merkleroot,
+		Time:              header.Time,
+	}
+
+	//补充本地保存的交易单列表，没有保存时为空
+	if txs, findErr := bs.GetLocalBlockTxs(header.Hash); findErr == nil {
+		block.Version = txs.Version
+		block.tx = txs.TxIDs
+		block.relevantTxs = txs.RelevantTxs
 	}
 
 	return block, nil
@@ -104,3 +146,198 @@ func (bs *FIIIBlockScanner) GetUnscanRecords() ([]*openwallet.UnscanRecord, erro
 
 	return bs.BlockchainDAI.GetUnscanRecords(bs.wm.Symbol())
 }
+
+//openBlockchainDB 返回本地区块链数据库，第一次使用时打开，之后各线程共用同一个连接，扫描器关闭时才关闭
+func (bs *FIIIBlockScanner) openBlockchainDB() (*storm.DB, error) {
+
+	bs.blockchainDBMu.Lock()
+	defer bs.blockchainDBMu.Unlock()
+
+	if bs.blockchainDB != nil {
+		return bs.blockchainDB, nil
+	}
+
+	db, err := storm.Open(filepath.Join(bs.wm.Config.dbPath, bs.wm.Config.BlockchainFile))
+	if err != nil {
+		return nil, err
+	}
+	bs.blockchainDB = db
+	return db, nil
+}
+
+//closeBlockchainDB 关闭本地区块链数据库
+func (bs *FIIIBlockScanner) closeBlockchainDB() error {
+
+	bs.blockchainDBMu.Lock()
+	defer bs.blockchainDBMu.Unlock()
+
+	if bs.blockchainDB == nil {
+		return nil
+	}
+
+	err := bs.blockchainDB.Close()
+	bs.blockchainDB = nil
+	return err
+}
+
+//saveLocalBlockTxs 保存区块的交易单列表和相关交易单，并清理超过缓存数量的旧区块
+func (bs *FIIIBlockScanner) saveLocalBlockTxs(block *Block) error {
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return err
+	}
+
+	txs := &LocalBlockTxs{
+		Hash:              block.Hash,
+		Height:            block.Height,
+		Previousblockhash: block.Previousblockhash,
+		Version:           block.Version,
+		Time:              block.Time,
+		TxIDs:             block.tx,
+		RelevantTxs:       block.relevantTxs,
+	}
+
+	err = db.Save(txs)
+	if err != nil {
+		return err
+	}
+
+	cacheSize := bs.wm.Config.BlockTxsCacheSize
+	if cacheSize > 0 && block.Height > cacheSize {
+		err = db.Select(q.Lte("Height", block.Height-cacheSize)).Delete(&LocalBlockTxs{})
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//mergeLocalBlockRelevantTxs 重扫区块后合并相关交易单，本地没有保存该区块时忽略
+func (bs *FIIIBlockScanner) mergeLocalBlockRelevantTxs(blockHash string, relevantTxs map[string][]string) error {
+
+	if len(relevantTxs) == 0 {
+		return nil
+	}
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return err
+	}
+
+	//共用数据库连接，读取和保存在同一个事务中，避免并发合并时互相覆盖
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var txs LocalBlockTxs
+	err = tx.One("Hash", blockHash, &txs)
+	if err != nil {
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if txs.RelevantTxs == nil {
+		txs.RelevantTxs = make(map[string][]string)
+	}
+	for txid, sourceKeys := range relevantTxs {
+		txs.RelevantTxs[txid] = mergeSourceKeys(txs.RelevantTxs[txid], sourceKeys)
+	}
+
+	err = tx.Save(&txs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//GetLocalBlockTxs 获取本地保存的区块交易单列表，收到分叉区块通知时，可以查询需要回滚的相关交易单
+func (bs *FIIIBlockScanner) GetLocalBlockTxs(blockHash string) (*LocalBlockTxs, error) {
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs LocalBlockTxs
+	err = db.One("Hash", blockHash, &txs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txs, nil
+}
+
+//saveAddressUsage 保存提取结果中钱包地址的使用记录
+func (bs *FIIIBlockScanner) saveAddressUsage(txid string, extractData map[string]*openwallet.TxExtractData) error {
+
+	addresses := make(map[string]bool)
+	for _, data := range extractData {
+		for _, input := range data.TxInputs {
+			addresses[input.Address] = true
+		}
+		for _, output := range data.TxOutputs {
+			addresses[output.Address] = true
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return err
+	}
+
+	for address := range addresses {
+		err = db.Save(&LocalAddressUsage{Address: address, TxID: txid})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//GetUsedAddresses 返回addresses中有使用记录的地址
+func (bs *FIIIBlockScanner) GetUsedAddresses(addresses ...string) (map[string]bool, error) {
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, address := range addresses {
+		var usage LocalAddressUsage
+		err = db.One("Address", address, &usage)
+		if err == nil {
+			used[address] = true
+		} else if err != storm.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	return used, nil
+}
+
+//mergeSourceKeys 合并去重后排序
+func mergeSourceKeys(a, b []string) []string {
+	keys := make(map[string]bool)
+	for _, k := range append(append([]string{}, a...), b...) {
+		keys[k] = true
+	}
+	merged := make([]string, 0, len(keys))
+	for k := range keys {
+		merged = append(merged, k)
+	}
+	sort.Strings(merged)
+	return merged
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/openwallet"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//默认的确认数通知节点：首次确认、可用、最终确认
+	defaultConfirmMilestones = "1,6,12"
+)
+
+//ConfirmTrackedTx 已提取的相关交易单，达到确认数节点时再次通知，达到最终确认数后不再跟踪
+type ConfirmTrackedTx struct {
+	TxID        string `storm:"id"`
+	BlockHash   string
+	BlockHeight uint64                               `storm:"index"`
+	Milestone   uint64                               //已通知的确认数节点
+	ExtractData map[string]*openwallet.TxExtractData //最近一次通知的提取结果，交易单被丢弃时使用
+}
+
+//ParseConfirmMilestones 解析逗号分隔的确认数节点，必须大于0并按升序排列，最后一个为最终确认数，空字符串不跟踪确认数
+func ParseConfirmMilestones(milestones string) ([]uint64, error) {
+	list := make([]uint64, 0)
+	for _, item := range strings.Split(milestones, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		m, err := strconv.ParseUint(item, 10, 64)
+		if err != nil || m == 0 {
+			return nil, fmt.Errorf("invalid confirmation milestone: %s", item)
+		}
+		if len(list) > 0 && m <= list[len(list)-1] {
+			return nil, fmt.Errorf("confirmation milestones: %s should be in ascending order", milestones)
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+//reachedMilestone 确认数已达到的最高节点，没有达到任何节点返回0
+func reachedMilestone(milestones []uint64, confirmations uint64) uint64 {
+	i := sort.Search(len(milestones), func(i int) bool { return milestones[i] > confirmations })
+	if i == 0 {
+		return 0
+	}
+	return milestones[i-1]
+}
+
+//trackConfirmations 跟踪区块中提取到的交易单，重扫相同区块时保留已通知的节点
+func (bs *FIIIBlockScanner) trackConfirmations(blockHeight uint64, blockHash string, txid string, extractData map[string]*openwallet.TxExtractData) error {
+
+	milestones := bs.wm.Config.ConfirmMilestones
+	if len(milestones) == 0 || blockHeight == 0 || len(extractData) == 0 {
+		return nil
+	}
+
+	//重扫失败记录时没有区块hash，使用交易单的区块hash
+	var confirmations uint64
+	for _, data := range extractData {
+		if data.Transaction == nil {
+			continue
+		}
+		if data.Transaction.Confirm > 0 {
+			confirmations = uint64(data.Transaction.Confirm)
+		}
+		if len(blockHash) == 0 {
+			blockHash = data.Transaction.BlockHash
+		}
+	}
+	if len(blockHash) == 0 {
+		return nil
+	}
+
+	//已达到最终确认数，不需要跟踪
+	milestone := reachedMilestone(milestones, confirmations)
+	if milestone == milestones[len(milestones)-1] {
+		return nil
+	}
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return err
+	}
+
+	//读取已通知的确认数和保存在同一个事务中
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tracked ConfirmTrackedTx
+	err = tx.One("TxID", txid, &tracked)
+	if err == nil && tracked.BlockHash == blockHash && tracked.Milestone > milestone {
+		milestone = tracked.Milestone
+	}
+
+	err = tx.Save(&ConfirmTrackedTx{
+		TxID:        txid,
+		BlockHash:   blockHash,
+		BlockHeight: blockHeight,
+		Milestone:   milestone,
+		ExtractData: extractData,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//GetConfirmTrackedTxs 获取正在跟踪确认数的交易单
+func (bs *FIIIBlockScanner) GetConfirmTrackedTxs() ([]*ConfirmTrackedTx, error) {
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*ConfirmTrackedTx
+	err = db.All(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//saveConfirmTrackedTx 更新跟踪记录，remove为true时删除
+func (bs *FIIIBlockScanner) saveConfirmTrackedTx(tracked *ConfirmTrackedTx, remove bool) error {
+
+	db, err := bs.openBlockchainDB()
+	if err != nil {
+		return err
+	}
+
+	if remove {
+		err = db.DeleteStruct(tracked)
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return db.Save(tracked)
+}
+
+//notifyConfirmations 检查跟踪中的交易单，达到新的确认数节点时再次通知提取结果，
+//交易单所在区块被分叉且节点找不到该交易单时，发送丢弃通知
+func (bs *FIIIBlockScanner) notifyConfirmations(tipHeight uint64) {
+
+	milestones := bs.wm.Config.ConfirmMilestones
+	if len(milestones) == 0 {
+		return
+	}
+
+	list, err := bs.GetConfirmTrackedTxs()
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not get confirmation tracked transactions; unexpected error: %v", err)
+		return
+	}
+
+	hashes := make(map[uint64]string)
+
+	for _, tracked := range list {
+
+		if tracked.BlockHeight > tipHeight {
+			continue
+		}
+
+		nodeHash, ok := hashes[tracked.BlockHeight]
+		if !ok {
+			nodeHash, err = bs.wm.GetBlockHash(tracked.BlockHeight)
+			if err != nil {
+				bs.wm.Log.Std.Info("block scanner can not get block hash: %d; unexpected error: %v", tracked.BlockHeight, err)
+				continue
+			}
+			hashes[tracked.BlockHeight] = nodeHash
+		}
+
+		//所在区块已被分叉
+		if !strings.EqualFold(nodeHash, tracked.BlockHash) {
+			bs.checkDroppedTx(tracked)
+			continue
+		}
+
+		confirmations := tipHeight - tracked.BlockHeight + 1
+		milestone := reachedMilestone(milestones, confirmations)
+		if milestone <= tracked.Milestone {
+			continue
+		}
+
+		trx, err := bs.wm.GetTransaction(tracked.TxID)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not get transaction: %s; unexpected error: %v", tracked.TxID, err)
+			continue
+		}
+		trx.BlockHeight = tracked.BlockHeight
+		trx.BlockHash = tracked.BlockHash
+		trx.Confirmations = confirmations
+
+		result := ExtractResult{
+			BlockHeight: tracked.BlockHeight,
+			TxID:        tracked.TxID,
+			extractData: make(map[string]*openwallet.TxExtractData),
+		}
+		bs.extractTransaction(trx, &result, bs.ScanAddressFunc)
+
+		isFinal := milestone == milestones[len(milestones)-1]
+		for _, data := range result.extractData {
+			data.Transaction.SetExtParam("confirmMilestone", milestone)
+			data.Transaction.SetExtParam("isFinal", isFinal)
+		}
+
+		bs.wm.Log.Std.Info("transaction: %s reaches confirmation milestone: %d", tracked.TxID, milestone)
+
+		bs.newExtractDataNotify(tracked.BlockHeight, result.extractData)
+
+		tracked.Milestone = milestone
+		tracked.ExtractData = result.extractData
+		err = bs.saveConfirmTrackedTx(tracked, isFinal)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not save confirmation tracked transaction: %s; unexpected error: %v", tracked.TxID, err)
+		}
+	}
+}
+
+//checkDroppedTx 所在区块被分叉后，交易单被打包到新区块时由扫描新区块更新跟踪记录，
+//回到交易池时继续等待，节点找不到或已丢弃时发送丢弃通知并停止跟踪
+func (bs *FIIIBlockScanner) checkDroppedTx(tracked *ConfirmTrackedTx) {
+
+	trx, err := bs.wm.GetTransaction(tracked.TxID)
+	if err != nil && !IsRPCErrorCode(err, RPCErrInvalidAddressOrKey) {
+		bs.wm.Log.Std.Info("block scanner can not get transaction: %s; unexpected error: %v", tracked.TxID, err)
+		return
+	}
+
+	if err == nil && !trx.IsDiscarded {
+		return
+	}
+
+	bs.wm.Log.Std.Notice("transaction: %s in orphaned block: %d %s is dropped", tracked.TxID, tracked.BlockHeight, tracked.BlockHash)
+
+	for _, data := range tracked.ExtractData {
+		if data.Transaction != nil {
+			data.Transaction.Status = openwallet.TxStatusFail
+			data.Transaction.Reason = "transaction is dropped"
+			data.Transaction.SetExtParam("isDropped", true)
+		}
+		for _, output := range data.TxOutputs {
+			output.SetExtParam("isDropped", true)
+		}
+	}
+
+	bs.newExtractDataNotify(tracked.BlockHeight, tracked.ExtractData)
+
+	err = bs.saveConfirmTrackedTx(tracked, true)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not delete confirmation tracked transaction: %s; unexpected error: %v", tracked.TxID, err)
+	}
+}
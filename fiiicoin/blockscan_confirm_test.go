@@ -0,0 +1,153 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/blocktree/openwallet/openwallet"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseConfirmMilestones(t *testing.T) {
+	tests := []struct {
+		milestones string
+		want       []uint64
+		wantErr    bool
+	}{
+		{"1,6,12", []uint64{1, 6, 12}, false},
+		{" 1, 3 ", []uint64{1, 3}, false},
+		{"", []uint64{}, false},
+		{"0,6", nil, true},
+		{"6,1", nil, true},
+		{"1,x", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseConfirmMilestones(test.milestones)
+		if (err != nil) != test.wantErr || len(got) != len(test.want) {
+			t.Errorf("ParseConfirmMilestones(%q) = %v, %v, want: %v", test.milestones, got, err, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("ParseConfirmMilestones(%q) = %v, want: %v", test.milestones, got, test.want)
+			}
+		}
+	}
+}
+
+func TestFIIIBlockScanner_ConfirmMilestones(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 1))
+	payB := NewMockCoinbase(mockAddressB, 1000000000, 2)
+	node.AddBlock(payB)
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, observer := testMockScanner(node, dir)
+	bs.wm.Config.ConfirmMilestones = []uint64{1, 3, 4}
+
+	//首次提取时有1个确认
+	bs.ScanBlockTask()
+	extracts := observer.waitExtracts(1)
+	if len(extracts) != 1 || extracts[0].Transaction.TxID != payB.Hash || extracts[0].TxOutputs[0].Confirm != 1 {
+		t.Errorf("first extract notifications: %+v", extracts)
+		return
+	}
+
+	tests := []struct {
+		blocks  int
+		confirm int64
+		isFinal bool
+	}{
+		{2, 3, false},
+		{1, 4, true},
+	}
+	for i, test := range tests {
+		for j := 0; j < test.blocks; j++ {
+			node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 10*i+j+10))
+		}
+		bs.ScanBlockTask()
+		extracts = observer.waitExtracts(1)
+		if len(extracts) != 1 {
+			t.Errorf("milestone: %d notifications: %d, want 1", test.confirm, len(extracts))
+			return
+		}
+		tx := extracts[0].Transaction
+		if tx.Confirm != test.confirm || extracts[0].TxOutputs[0].Confirm != test.confirm ||
+			tx.GetExtParam().Get("confirmMilestone").Int() != test.confirm || tx.GetExtParam().Get("isFinal").Bool() != test.isFinal {
+			t.Errorf("milestone: %d notification: %+v", test.confirm, tx)
+		}
+	}
+
+	//达到最终确认数后不再跟踪
+	tracked, err := bs.GetConfirmTrackedTxs()
+	if err != nil || len(tracked) != 0 {
+		t.Errorf("tracked transactions: %d, error: %v", len(tracked), err)
+	}
+}
+
+func TestFIIIBlockScanner_ConfirmDropped(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 1))
+	payB := NewMockCoinbase(mockAddressB, 1000000000, 2)
+	node.AddBlock(payB)
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, observer := testMockScanner(node, dir)
+	bs.ScanBlockTask()
+	if extracts := observer.waitExtracts(1); len(extracts) != 1 {
+		t.Errorf("extract notifications: %d, want 1", len(extracts))
+		return
+	}
+
+	//区块2被替换，新链中没有转给B的交易单
+	node.RemoveBlocks(1)
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 102))
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 103))
+	bs.ScanBlockTask()
+
+	extracts := observer.waitExtracts(1)
+	if len(extracts) != 1 {
+		t.Errorf("dropped notifications: %d, want 1", len(extracts))
+		return
+	}
+	tx := extracts[0].Transaction
+	if tx.TxID != payB.Hash || tx.Status != openwallet.TxStatusFail || !tx.GetExtParam().Get("isDropped").Bool() ||
+		!extracts[0].TxOutputs[0].GetExtParam().Get("isDropped").Bool() {
+		t.Errorf("dropped notification: %+v", tx)
+	}
+
+	tracked, err := bs.GetConfirmTrackedTxs()
+	if err != nil || len(tracked) != 0 {
+		t.Errorf("tracked transactions: %d, error: %v", len(tracked), err)
+	}
+}
@@ -0,0 +1,419 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+//testBlockchainDAI 内存中的区块链数据
+type testBlockchainDAI struct {
+	openwallet.BlockchainDAIBase
+	mu      sync.Mutex
+	head    *openwallet.BlockHeader
+	headers map[uint64]*openwallet.BlockHeader
+	unscans map[uint64]*openwallet.UnscanRecord
+}
+
+func newTestBlockchainDAI() *testBlockchainDAI {
+	return &testBlockchainDAI{
+		headers: make(map[uint64]*openwallet.BlockHeader),
+		unscans: make(map[uint64]*openwallet.UnscanRecord),
+	}
+}
+
+func (dai *testBlockchainDAI) SaveCurrentBlockHead(header *openwallet.BlockHeader) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.head = header
+	return nil
+}
+
+func (dai *testBlockchainDAI) GetCurrentBlockHead(symbol string) (*openwallet.BlockHeader, error) {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	if dai.head == nil {
+		return nil, fmt.Errorf("no block head")
+	}
+	return dai.head, nil
+}
+
+func (dai *testBlockchainDAI) SaveLocalBlockHead(header *openwallet.BlockHeader) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.headers[header.Height] = header
+	return nil
+}
+
+func (dai *testBlockchainDAI) GetLocalBlockHeadByHeight(height uint64, symbol string) (*openwallet.BlockHeader, error) {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	header, ok := dai.headers[height]
+	if !ok {
+		return nil, fmt.Errorf("block: %d not found", height)
+	}
+	return header, nil
+}
+
+func (dai *testBlockchainDAI) SaveUnscanRecord(record *openwallet.UnscanRecord) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	dai.unscans[record.BlockHeight] = record
+	return nil
+}
+
+func (dai *testBlockchainDAI) DeleteUnscanRecordByHeight(height uint64, symbol string) error {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	delete(dai.unscans, height)
+	return nil
+}
+
+func (dai *testBlockchainDAI) GetUnscanRecords(symbol string) ([]*openwallet.UnscanRecord, error) {
+	dai.mu.Lock()
+	defer dai.mu.Unlock()
+	records := make([]*openwallet.UnscanRecord, 0)
+	for _, r := range dai.unscans {
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+//testBlockObserver 记录区块通知和提取结果通知
+type testBlockObserver struct {
+	headers  chan *openwallet.BlockHeader
+	extracts chan *openwallet.TxExtractData
+}
+
+func (o *testBlockObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	o.headers <- header
+	return nil
+}
+
+func (o *testBlockObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.extracts <- data
+	return nil
+}
+
+//wait 等待n个区块通知
+func (o *testBlockObserver) wait(n int) []*openwallet.BlockHeader {
+	headers := make([]*openwallet.BlockHeader, 0, n)
+	for len(headers) < n {
+		select {
+		case header := <-o.headers:
+			headers = append(headers, header)
+		case <-time.After(2 * time.Second):
+			return headers
+		}
+	}
+	return headers
+}
+
+//waitExtracts 等待n个提取结果通知
+func (o *testBlockObserver) waitExtracts(n int) []*openwallet.TxExtractData {
+	extracts := make([]*openwallet.TxExtractData, 0, n)
+	for len(extracts) < n {
+		select {
+		case data := <-o.extracts:
+			extracts = append(extracts, data)
+		case <-time.After(2 * time.Second):
+			return extracts
+		}
+	}
+	return extracts
+}
+
+//testMockScanner 连接模拟节点的扫描器，从高度2开始扫描，本地数据库保存在dbPath
+func testMockScanner(node *MockNode, dbPath string) (*FIIIBlockScanner, *testBlockchainDAI, *testBlockObserver) {
+	wm := testMockWalletManager(node)
+	wm.Config.NodeReadyCheck = false
+	wm.Config.dbPath = dbPath
+
+	dai := newTestBlockchainDAI()
+	observer := &testBlockObserver{
+		headers:  make(chan *openwallet.BlockHeader, 100),
+		extracts: make(chan *openwallet.TxExtractData, 100),
+	}
+
+	bs := wm.Blockscanner
+	bs.SetBlockchainDAI(dai)
+	bs.AddObserver(observer)
+	bs.SetBlockScanTargetFunc(func(target openwallet.ScanTarget) (string, bool) {
+		return "accountB", target.Address == mockAddressB
+	})
+	bs.Scanning = true
+	bs.SaveLocalBlockHead(1, node.blocks[1].Header.Hash)
+	bs.SaveLocalBlock(&Block{Height: 1, Hash: node.blocks[1].Header.Hash})
+
+	return bs, dai, observer
+}
+
+func TestFIIIBlockScanner_Reorg(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 4; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+	//被分叉的区块5中有转给B的交易单
+	payB := NewMockCoinbase(mockAddressB, 1000000000, 5)
+	node.AddBlock(payB)
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, dai, observer := testMockScanner(node, dir)
+	bs.ScanBlockTask()
+	if headers := observer.wait(4); len(headers) != 4 {
+		t.Errorf("new block notifications: %d, want 4", len(headers))
+		return
+	}
+
+	orphaned := []string{node.blocks[5].Header.Hash, node.blocks[4].Header.Hash, node.blocks[3].Header.Hash}
+
+	//最新的3个区块被替换，新链更长
+	node.RemoveBlocks(3)
+	for i := 103; i <= 106; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+	dai.SaveUnscanRecord(openwallet.NewUnscanRecord(4, "", "test", Symbol))
+
+	bs.ScanBlockTask()
+
+	//先从高到低通知3个分叉区块，再通知新链的4个区块
+	headers := observer.wait(7)
+	if len(headers) != 7 {
+		t.Errorf("notifications: %d, want 7", len(headers))
+		return
+	}
+	for i, hash := range orphaned {
+		if !headers[i].Fork || headers[i].Hash != hash {
+			t.Errorf("notification[%d] should be fork block: %s, got: %+v", i, hash, headers[i])
+		}
+	}
+	for i, header := range headers[3:] {
+		if header.Fork || header.Height != uint64(i+3) || header.Hash != node.blocks[i+3].Header.Hash {
+			t.Errorf("notification[%d] should be new block: %d, got: %+v", i+3, i+3, header)
+		}
+	}
+
+	if len(dai.unscans) != 0 {
+		t.Errorf("unscan records of fork blocks should be deleted")
+	}
+
+	height, hash, _ := bs.GetLocalBlockHead()
+	if height != 6 || hash != node.blocks[6].Header.Hash {
+		t.Errorf("local block head: %d %s, want: 6 %s", height, hash, node.blocks[6].Header.Hash)
+	}
+
+	//分叉区块的交易单列表保留在本地
+	forkTxs, err := bs.GetLocalBlockTxs(orphaned[0])
+	if err != nil || len(forkTxs.TxIDs) != 1 || len(forkTxs.RelevantTxs[payB.Hash]) != 1 || forkTxs.RelevantTxs[payB.Hash][0] != "accountB" {
+		t.Errorf("fork block txs: %+v, error: %v", forkTxs, err)
+	}
+
+	localBlock, err := bs.GetLocalBlock(5)
+	if err != nil || localBlock.Hash != node.blocks[5].Header.Hash || len(localBlock.TxIDs()) != 1 || len(localBlock.RelevantTxIDs()) != 0 {
+		t.Errorf("local block: %+v, error: %v", localBlock, err)
+	}
+}
+
+func TestFIIIBlockScanner_SharedBlockchainDB(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 1))
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, _ := testMockScanner(node, dir)
+	err = bs.saveLocalBlockTxs(&Block{Height: 2, Hash: "block2"})
+	if err != nil {
+		t.Errorf("saveLocalBlockTxs failed unexpected error: %v", err)
+		return
+	}
+
+	//多个线程同时合并同一个区块的相关交易单，不能互相覆盖
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := bs.mergeLocalBlockRelevantTxs("block2", map[string][]string{fmt.Sprintf("tx%d", i): {"account"}}); err != nil {
+				t.Errorf("mergeLocalBlockRelevantTxs failed unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	txs, err := bs.GetLocalBlockTxs("block2")
+	if err != nil || len(txs.RelevantTxs) != 20 {
+		t.Errorf("local block txs: %+v, error: %v, want 20 relevant txs", txs, err)
+	}
+
+	//关闭扫描器后释放数据库，再次使用时重新打开
+	if err := bs.CloseBlockScanner(); err != nil {
+		t.Errorf("CloseBlockScanner failed unexpected error: %v", err)
+	}
+	if bs.blockchainDB != nil {
+		t.Errorf("blockchain db should be closed with the block scanner")
+	}
+	if txs, err := bs.GetLocalBlockTxs("block2"); err != nil || len(txs.RelevantTxs) != 20 {
+		t.Errorf("reopen local block txs: %+v, error: %v", txs, err)
+	}
+	bs.closeBlockchainDB()
+}
+
+func TestFIIIBlockScanner_ReorgTooDeep(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 5; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, observer := testMockScanner(node, dir)
+	bs.MaxReorgDepth = 2
+	bs.ScanBlockTask()
+	observer.wait(4)
+	head := node.blocks[5].Header.Hash
+
+	node.RemoveBlocks(3)
+	for i := 103; i <= 106; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	bs.ScanBlockTask()
+
+	//分叉超过最大深度时不回退，也不通知
+	if headers := observer.wait(1); len(headers) != 0 {
+		t.Errorf("should not notify blocks, got: %+v", headers[0])
+	}
+	if height, hash, _ := bs.GetLocalBlockHead(); height != 5 || hash != head {
+		t.Errorf("local block head: %d %s, want: 5 %s", height, hash, head)
+	}
+}
+
+func TestFIIIBlockScanner_ReorgMissingLocalBlock(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 5; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, dai, observer := testMockScanner(node, dir)
+	bs.ScanBlockTask()
+	observer.wait(4)
+	head := node.blocks[5].Header.Hash
+
+	//本地缺少区块2和4，用区块3和5记录的前一区块hash比较
+	delete(dai.headers, 2)
+	delete(dai.headers, 4)
+
+	node.RemoveBlocks(3)
+	for i := 103; i <= 105; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+
+	ancestor, forkBlocks, err := bs.findForkAncestor(5, head)
+	if err != nil || ancestor.Height != 2 || ancestor.Hash != node.blocks[2].Header.Hash || len(forkBlocks) != 3 {
+		t.Errorf("ancestor: %+v, fork blocks: %d, error: %v", ancestor, len(forkBlocks), err)
+	}
+
+	//本地连续缺少区块3和4，无法确认祖先区块时返回错误，不能假定节点区块就是祖先
+	delete(dai.headers, 3)
+	if ancestor, _, err := bs.findForkAncestor(5, head); err == nil {
+		t.Errorf("should not resolve fork without local blocks, got ancestor: %+v", ancestor)
+	}
+}
+
+func TestFIIIBlockScanner_GetBlockFailed(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	for i := 1; i <= 4; i++ {
+		node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, i))
+	}
+	failedHash := node.blocks[3].Header.Hash
+
+	//区块3获取失败，扫描器记录未扫区块后继续扫描区块4
+	node.SetHandler("GetBlock", func(params []gjson.Result) (interface{}, error) {
+		if len(params) > 0 && params[0].String() == failedHash {
+			return nil, &RPCError{Code: RPCErrDatabase, Message: "block data is broken"}
+		}
+		return node.getBlock(params)
+	})
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, dai, observer := testMockScanner(node, dir)
+	bs.ScanBlockTask()
+
+	//区块4的前一区块与本地区块2不一致，但本地没有区块3，不能当作分叉通知
+	headers := observer.wait(2)
+	if len(headers) != 1 || headers[0].Fork || headers[0].Height != 2 {
+		t.Errorf("should only notify block 2, got: %+v", headers)
+	}
+	if height, hash, _ := bs.GetLocalBlockHead(); height != 2 || hash != node.blocks[2].Header.Hash {
+		t.Errorf("local block head: %d %s, want: 2 %s", height, hash, node.blocks[2].Header.Hash)
+	}
+	if _, ok := dai.unscans[3]; !ok {
+		t.Errorf("block 3 should have unscan record")
+	}
+
+	//节点恢复后从区块3继续扫描
+	node.SetHandler("GetBlock", node.getBlock)
+	bs.ScanBlockTask()
+	headers = observer.wait(2)
+	if len(headers) != 2 || headers[0].Fork || headers[0].Height != 3 || headers[1].Height != 4 {
+		t.Errorf("should notify block 3 and 4, got: %+v", headers)
+	}
+}
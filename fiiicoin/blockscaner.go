@@ -16,10 +16,13 @@
 package fiiicoin
 
 import (
+	"context"
 	"fmt"
+	"github.com/asdine/storm"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"sync"
 	"time"
 )
 
@@ -27,6 +30,8 @@ const (
 	//blockchainBucket = "blockchain" //区块链数据集合
 	//periodOfTask      = 5 * time.Second //定时任务执行隔间
 	maxExtractingSize = 10 //并发的扫描线程数
+	//默认分叉时最多回退的区块数量
+	defaultMaxReorgDepth = 100
 )
 
 //FIIIBlockScanner fiiicoin的区块链扫描器
@@ -38,7 +43,11 @@ type FIIIBlockScanner struct {
 	wm                   *WalletManager //钱包管理者
 	IsScanMemPool        bool           //是否扫描交易池
 	RescanLastBlockCount uint64         //重扫上N个区块数量
+	MaxReorgDepth        uint64         //分叉时最多回退的区块数量
+	PrefetchBlocks       int            //追块时并发预取的区块数量，不大于1时逐个获取
 
+	blockchainDB   *storm.DB  //本地区块链数据库，扫描器关闭前一直打开，多个线程共用
+	blockchainDBMu sync.Mutex //打开和关闭本地区块链数据库的锁
 }
 
 //ExtractResult 扫描完成的提取结果
@@ -66,6 +75,7 @@ func NewFIIIBlockScanner(wm *WalletManager) *FIIIBlockScanner {
 	bs.wm = wm
 	bs.IsScanMemPool = false
 	bs.RescanLastBlockCount = 1
+	bs.MaxReorgDepth = defaultMaxReorgDepth
 
 	//设置扫描任务
 	bs.SetTask(bs.ScanBlockTask)
@@ -103,6 +113,16 @@ func (bs *FIIIBlockScanner) ScanBlockTask() {
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+	//节点未同步完成时暂停，等待下一次任务
+	if err := bs.wm.checkNodeReadyIfEnabled(); err != nil {
+		bs.wm.Log.Std.Warning("block scanner paused, %v", err)
+		return
+	}
+
+	//落后多个区块时并发预取，按高度顺序处理
+	prefetcher := newBlockPrefetcher(bs.wm, bs.PrefetchBlocks)
+	defer prefetcher.Stop()
+
 	for {
 
 		if !bs.Scanning {
@@ -129,15 +149,27 @@ func (bs *FIIIBlockScanner) ScanBlockTask() {
 
 		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
 
-		hash, err := bs.wm.GetBlockHash(currentHeight)
+		fetched := prefetcher.Fetch(currentHeight, maxHeight)
+
+		hash, err := fetched.hash, fetched.hashErr
 		if err != nil {
 			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+			if IsRPCErrorCode(err, RPCErrInvalidParameter) {
+				bs.wm.Log.Std.Info("block scanner can not find block height: %d, the node may be reorganizing", currentHeight)
+			} else {
+				bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
+			}
 			break
 		}
 
-		block, err := bs.wm.GetBlock(hash)
+		block, err := fetched.block, fetched.blockErr
 		if err != nil {
+			//节点无法访问时停止本次扫描，下次从当前高度继续，避免跳过区块
+			if IsNodeUnavailable(err) {
+				bs.wm.Log.Std.Info("block scanner can not get new block data, node is unavailable; unexpected error: %v", err)
+				break
+			}
+
 			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
 			//记录未扫区块
@@ -156,60 +188,37 @@ func (bs *FIIIBlockScanner) ScanBlockTask() {
 			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
 			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.Previousblockhash)
 
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
-
-			//查询本地分叉的区块
-			forkBlock, _ := bs.GetLocalBlock(currentHeight - 1)
-
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			//删除上一区块链的未扫记录
-			bs.DeleteUnscanRecord(currentHeight - 1)
-			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
-			}
-
-			localBlock, err := bs.GetLocalBlock(currentHeight)
+			//向前查找与节点一致的共同祖先区块
+			ancestor, forkBlocks, err := bs.findForkAncestor(currentHeight-1, currentHash)
 			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
-
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
-
-				prevHash, err := bs.wm.GetBlockHash(currentHeight)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
-				}
-
-				localBlock, err = bs.wm.GetBlock(prevHash)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
-				}
-
+				bs.wm.Log.Std.Error("block scanner can not resolve fork on height: %d; unexpected error: %v", currentHeight, err)
+				break
 			}
 
 			//重置当前区块的hash
-			currentHash = localBlock.Hash
+			currentHeight = ancestor.Height
+			currentHash = ancestor.Hash
 
 			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
 
 			//重新记录一个新扫描起点
-			bs.SaveLocalBlockHead(localBlock.Height, localBlock.Hash)
+			bs.SaveLocalBlockHead(ancestor.Height, ancestor.Hash)
 
 			isFork = true
 
-			if forkBlock != nil {
-
-				//通知分叉区块给观测者，异步处理
+			//删除分叉区块的未扫记录，并从高到低通知分叉区块给观测者，异步处理
+			//分叉区块的交易单列表仍保留在本地，观测者可以通过GetLocalBlockTxs查询需要回滚的交易单
+			for _, forkBlock := range forkBlocks {
+				if relevant := forkBlock.RelevantTxIDs(); len(relevant) > 0 {
+					bs.wm.Log.Std.Notice("fork block: %d %s has relevant transactions: %v", forkBlock.Height, forkBlock.Hash, relevant)
+				}
+				bs.DeleteUnscanRecord(forkBlock.Height)
 				bs.newBlockNotify(forkBlock, isFork)
 			}
 
 		} else {
 
-			err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+			block.relevantTxs, err = bs.batchExtractTransaction(block.Height, block.Hash, block.tx, block.TxDetails(), maxHeight)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			}
@@ -234,6 +243,9 @@ func (bs *FIIIBlockScanner) ScanBlockTask() {
 		bs.scanBlock(i)
 	}
 
+	//通知达到确认数节点或被丢弃的交易单
+	bs.notifyConfirmations(currentHeight)
+
 	if bs.IsScanMemPool {
 		//扫描交易内存池
 		bs.ScanTxMemPool()
@@ -244,12 +256,63 @@ func (bs *FIIIBlockScanner) ScanBlockTask() {
 
 }
 
+//findForkAncestor 从本地扫描起点height开始向前比较本地区块和节点区块，返回共同祖先区块和按高度从高到低排列的分叉区块。
+//回退超过MaxReorgDepth仍未找到，或本地缺少区块无法比较时返回错误，需要人工设置重扫高度。
+func (bs *FIIIBlockScanner) findForkAncestor(height uint64, headHash string) (*Block, []*Block, error) {
+
+	forkBlocks := make([]*Block, 0)
+
+	//上一个比较的本地区块，本地缺少区块时用它记录的前一区块hash比较
+	var successor *Block
+
+	for depth := uint64(0); ; depth++ {
+
+		if depth >= bs.MaxReorgDepth {
+			return nil, forkBlocks, fmt.Errorf("fork is deeper than max reorg depth: %d", bs.MaxReorgDepth)
+		}
+
+		nodeHash, err := bs.wm.GetBlockHash(height)
+		if err != nil {
+			return nil, forkBlocks, err
+		}
+
+		localBlock, err := bs.GetLocalBlock(height)
+		if err != nil && depth == 0 {
+			//本地区块头在该高度时，扫描起点的hash已知；获取区块失败跳过的高度没有本地区块头，不能使用headHash
+			if headHeight, hash, headErr := bs.GetLocalBlockHead(); headErr == nil && headHeight == height && hash == headHash {
+				localBlock, err = &Block{Height: height, Hash: headHash}, nil
+			}
+		}
+		if err != nil {
+			//本地没有保存区块，后一个区块也没有记录前一区块hash时无法比较，需要人工设置重扫高度
+			if successor == nil || len(successor.Previousblockhash) == 0 {
+				return nil, forkBlocks, fmt.Errorf("can not compare block: %d with the node, local block is not found; unexpected error: %v", height, err)
+			}
+			localBlock = &Block{Height: height, Hash: successor.Previousblockhash}
+		}
+
+		if localBlock.Hash == nodeHash {
+			return localBlock, forkBlocks, nil
+		}
+
+		bs.wm.Log.Std.Info("block height: %d local hash: %s is orphaned by: %s", height, localBlock.Hash, nodeHash)
+
+		forkBlocks = append(forkBlocks, localBlock)
+		successor = localBlock
+
+		if height == 0 {
+			return nil, forkBlocks, fmt.Errorf("fork reaches the genesis block")
+		}
+		height = height - 1
+	}
+}
+
 //ScanBlock 扫描指定高度区块
 func (bs *FIIIBlockScanner) ScanBlock(height uint64) error {
 
 	block, err := bs.scanBlock(height)
 	if err != nil {
-		return err
+		return ConvertRPCError(err, openwallet.ErrUnknownException)
 	}
 
 	//通知新区块给观测者，异步处理
@@ -280,11 +343,14 @@ func (bs *FIIIBlockScanner) scanBlock(height uint64) (*Block, error) {
 
 	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+	block.relevantTxs, err = bs.batchExtractTransaction(block.Height, block.Hash, block.tx, block.TxDetails(), bs.tipBlockHeight())
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
 
+	//重扫时合并本地保存的相关交易单
+	bs.mergeLocalBlockRelevantTxs(block.Hash, block.relevantTxs)
+
 	return block, nil
 }
 
@@ -338,13 +404,18 @@ func (bs *FIIIBlockScanner) RescanFailedRecord() {
 		}
 	}
 
+	tipHeight := bs.tipBlockHeight()
+
 	for height, txs := range blockMap {
 
 		if height == 0 {
 			continue
 		}
 
-		var hash string
+		var (
+			hash      string
+			txDetails map[string]*Transaction
+		)
 
 		bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
 
@@ -364,14 +435,18 @@ func (bs *FIIIBlockScanner) RescanFailedRecord() {
 			}
 
 			txs = block.tx
+			txDetails = block.TxDetails()
 		}
 
-		err = bs.BatchExtractTransaction(height, hash, txs)
+		relevantTxs, err := bs.batchExtractTransaction(height, hash, txs, txDetails, tipHeight)
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			continue
 		}
 
+		//合并本地保存的相关交易单
+		bs.mergeLocalBlockRelevantTxs(hash, relevantTxs)
+
 		//删除未扫记录
 		bs.DeleteUnscanRecord(height)
 	}
@@ -388,16 +463,52 @@ func (bs *FIIIBlockScanner) newBlockNotify(block *Block, isFork bool) {
 //BatchExtractTransaction 批量提取交易单
 //fiiicoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *FIIIBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []string) error {
+	_, err := bs.batchExtractTransaction(blockHeight, blockHash, txs, nil, bs.tipBlockHeight())
+	return err
+}
+
+//batchExtractTransaction 批量提取交易单，返回与钱包相关的交易单: sourceKey
+//txDetails为区块中已包含完整数据的交易单，其余的交易单向节点请求，所有交易单的确认数都按节点最新高度tipHeight计算
+func (bs *FIIIBlockScanner) batchExtractTransaction(blockHeight uint64, blockHash string, txs []string, txDetails map[string]*Transaction, tipHeight uint64) (map[string][]string, error) {
 
 	var (
-		quit       = make(chan struct{})
-		done       = 0 //完成标记
-		failed     = 0
-		shouldDone = len(txs) //需要完成的总数
+		quit        = make(chan struct{})
+		done        = 0 //完成标记
+		failed      = 0
+		shouldDone  = len(txs) //需要完成的总数
+		relevantTxs = make(map[string][]string)
 	)
 
 	if len(txs) == 0 {
-		return fmt.Errorf("BatchExtractTransaction block is nil.")
+		return relevantTxs, fmt.Errorf("BatchExtractTransaction block is nil.")
+	}
+
+	//区块中已包含的交易单不需要再请求
+	trxs := make(map[string]*Transaction)
+	missing := make([]string, 0)
+	for _, txid := range txs {
+		if trx, ok := txDetails[txid]; ok {
+			trxs[txid] = trx
+		} else {
+			missing = append(missing, txid)
+		}
+	}
+
+	//批量获取交易单，获取失败的交易单再单独请求
+	if len(missing) > 0 {
+		fetched, err := bs.wm.GetTransactions(missing)
+		if err != nil {
+			bs.wm.Log.Std.Info("block height: %d batch get transactions failed, unexpected error: %v", blockHeight, err)
+		}
+		for txid, trx := range fetched {
+			trxs[txid] = trx
+		}
+	}
+
+	//区块中的交易单和请求的交易单使用同一个节点高度计算确认数
+	confirmations := bs.blockConfirmations(blockHeight, tipHeight)
+	for _, trx := range trxs {
+		trx.Confirmations = confirmations
 	}
 
 	//生产通道
@@ -415,6 +526,22 @@ func (bs *FIIIBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 
 			if gets.Success {
 
+				for sourceKey := range gets.extractData {
+					relevantTxs[gets.TxID] = mergeSourceKeys(relevantTxs[gets.TxID], []string{sourceKey})
+				}
+
+				//记录钱包地址的使用，找零策略fresh不会再选择这些地址
+				usageErr := bs.saveAddressUsage(gets.TxID, gets.extractData)
+				if usageErr != nil {
+					bs.wm.Log.Std.Info("block height: %d save address usage of transaction: %s failed, unexpected error: %v", height, gets.TxID, usageErr)
+				}
+
+				//跟踪确认数，达到确认数节点时再次通知
+				trackErr := bs.trackConfirmations(height, blockHash, gets.TxID, gets.extractData)
+				if trackErr != nil {
+					bs.wm.Log.Std.Info("block height: %d track confirmations of transaction: %s failed, unexpected error: %v", height, gets.TxID, trackErr)
+				}
+
 				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
 				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
 				if notifyErr != nil {
@@ -446,7 +573,7 @@ func (bs *FIIIBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 			go func(mBlockHeight uint64, mTxid string, end chan struct{}, mProducer chan<- ExtractResult) {
 
 				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, mTxid, bs.ScanAddressFunc)
+				mProducer <- bs.extractTransactionWithData(mBlockHeight, eBlockHash, mTxid, trxs[mTxid], tipHeight, bs.ScanAddressFunc)
 				//释放
 				<-end
 
@@ -466,14 +593,32 @@ func (bs *FIIIBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHas
 	bs.extractRuntime(producer, worker, quit)
 
 	if failed > 0 {
-		return fmt.Errorf("block scanner saveWork failed")
+		return relevantTxs, fmt.Errorf("block scanner saveWork failed")
 	} else {
-		return nil
+		return relevantTxs, nil
 	}
 
 	//return nil
 }
 
+//blockConfirmations 按节点最新高度计算区块的确认数，最新区块为1
+func (bs *FIIIBlockScanner) blockConfirmations(blockHeight, tipHeight uint64) uint64 {
+	if tipHeight < blockHeight {
+		return 1
+	}
+	return tipHeight - blockHeight + 1
+}
+
+//tipBlockHeight 节点最新高度，获取失败时使用本地扫描高度
+func (bs *FIIIBlockScanner) tipBlockHeight() uint64 {
+	tipHeight, err := bs.wm.GetBlockHeight()
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not get rpc-server block height, use the scanned height; unexpected error: %v", err)
+		return bs.GetScannedBlockHeight()
+	}
+	return tipHeight
+}
+
 //extractRuntime 提取运行时
 func (bs *FIIIBlockScanner) extractRuntime(producer chan ExtractResult, worker chan ExtractResult, quit chan struct{}) {
 
@@ -512,8 +657,15 @@ func (bs *FIIIBlockScanner) extractRuntime(producer chan ExtractResult, worker c
 
 //ExtractTransaction 提取交易单
 func (bs *FIIIBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
+	return bs.extractTransactionWithData(blockHeight, blockHash, txid, nil, 0, scanAddressFunc)
+}
+
+//extractTransactionWithData 提取已获取的交易单，trx为nil时从节点获取。
+//tipHeight大于0时，单独获取的交易单与批量获取的一样按节点最新高度计算区块中交易单的确认数
+func (bs *FIIIBlockScanner) extractTransactionWithData(blockHeight uint64, blockHash string, txid string, trx *Transaction, tipHeight uint64, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
 
 	var (
+		err    error
 		result = ExtractResult{
 			BlockHeight: blockHeight,
 			TxID:        txid,
@@ -523,12 +675,16 @@ func (bs *FIIIBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 	//bs.wm.Log.Std.Debug("block scanner scanning tx: %s ...", txid)
 	//获取fiiicoin的交易单
-	trx, err := bs.wm.GetTransaction(txid)
-
-	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
-		result.Success = false
-		return result
+	if trx == nil {
+		trx, err = bs.wm.GetTransaction(txid)
+		if err != nil {
+			bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
+			result.Success = false
+			return result
+		}
+		if tipHeight > 0 && blockHeight > 0 {
+			trx.Confirmations = bs.blockConfirmations(blockHeight, tipHeight)
+		}
 	}
 
 	//优先使用传入的高度
@@ -582,9 +738,19 @@ func (bs *FIIIBlockScanner) extractTransaction(trx *Transaction, result *Extract
 					BlockHeight: trx.BlockHeight,
 					TxID:        trx.TxID,
 					Decimal:     8,
+					Confirm:     int64(trx.Confirmations),
 					ConfirmTime: blocktime,
 					Status:      openwallet.TxStatusSuccess,
 				}
+				//过期或被丢弃的交易单标记为失败
+				if trx.ExpiredTime > 0 {
+					tx.SetExtParam("expiredTime", trx.ExpiredTime)
+				}
+				if trx.IsDiscarded {
+					tx.SetExtParam("isDiscarded", true)
+					tx.Status = openwallet.TxStatusFail
+					tx.Reason = "transaction is discarded"
+				}
 				wxID := openwallet.GenTransactionWxID(tx)
 				tx.WxID = wxID
 				extractData.Transaction = tx
@@ -711,6 +877,9 @@ func (bs *FIIIBlockScanner) extractTxOutput(trx *Transaction, result *ExtractRes
 			outPut.BlockHeight = trx.BlockHeight
 			outPut.BlockHash = trx.BlockHash
 			outPut.Confirm = int64(confirmations)
+			if trx.IsDiscarded || output.IsDiscarded {
+				outPut.SetExtParam("isDiscarded", true)
+			}
 
 			//transactions = append(transactions, &transaction)
 
@@ -837,12 +1006,12 @@ func (bs *FIIIBlockScanner) GetCurrentBlockHeader() (*openwallet.BlockHeader, er
 	blockHeight, err = bs.wm.GetBlockHeight()
 	if err != nil {
 
-		return nil, err
+		return nil, ConvertRPCError(err, openwallet.ErrUnknownException)
 	}
 
 	hash, err = bs.wm.GetBlockHash(blockHeight)
 	if err != nil {
-		return nil, err
+		return nil, ConvertRPCError(err, openwallet.ErrUnknownException)
 	}
 
 	return &openwallet.BlockHeader{Height: blockHeight, Hash: hash}, nil
@@ -958,22 +1127,27 @@ func (bs *FIIIBlockScanner) ExtractTransactionData(txid string, scanTargetFunc o
 //GetBlockHeight 获取区块链高度
 func (wm *WalletManager) GetBlockHeight() (uint64, error) {
 
-	result, err := wm.WalletClient.Call("GetBlockCount", nil)
-	if err != nil {
-		return 0, err
+	//多个节点时，取至少Quorum个节点都已达到的高度
+	if pool, ok := wm.WalletClient.(*ClientPool); ok {
+		return pool.QuorumBlockCount(context.Background())
 	}
 
-	return result.Uint(), nil
+	return wm.NodeAPI().GetBlockCount(context.Background())
 }
 
 //GetBlockHash 根据区块高度获得区块hash
 func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
 
+	pool, ok := wm.WalletClient.(*ClientPool)
+	if !ok {
+		return wm.NodeAPI().GetBlockHash(context.Background(), height)
+	}
+
 	request := []interface{}{
 		height,
 	}
 
-	result, err := wm.WalletClient.Call("GetBlockHash", request)
+	result, err := pool.QuorumCall(context.Background(), "GetBlockHash", request)
 	if err != nil {
 		return "", err
 	}
@@ -984,55 +1158,50 @@ func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
 //GetBlock 获取区块数据
 func (wm *WalletManager) GetBlock(hash string) (*Block, error) {
 
-	request := []interface{}{
-		hash,
-		1,
-	}
-
-	result, err := wm.WalletClient.Call("GetBlock", request)
-	if err != nil {
-		return nil, err
-	}
-
-	return NewBlock(result), nil
+	return wm.NodeAPI().GetBlock(context.Background(), hash)
 }
 
 //GetTxIDsInMemPool 获取待处理的交易池中的交易单IDs
 func (wm *WalletManager) GetTxIDsInMemPool() ([]string, error) {
 
-	var (
-		txids = make([]string, 0)
-	)
-
-	result, err := wm.WalletClient.Call("GetAllTxInMemPool", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	if !result.IsArray() {
-		return nil, fmt.Errorf("no query record")
-	}
-
-	for _, txid := range result.Array() {
-		txids = append(txids, txid.String())
-	}
-
-	return txids, nil
+	return wm.NodeAPI().GetAllTxInMemPool(context.Background())
 }
 
 //GetTransaction 获取交易单
 func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
 
-	request := []interface{}{
-		txid,
+	return wm.NodeAPI().GetTransaction(context.Background(), txid)
+}
+
+//GetTransactions 批量获取交易单，返回获取成功的交易单
+func (wm *WalletManager) GetTransactions(txids []string) (map[string]*Transaction, error) {
+
+	var (
+		trxs     = make(map[string]*Transaction)
+		requests = make([]*BatchRequest, 0, len(txids))
+	)
+
+	for _, txid := range txids {
+		requests = append(requests, &BatchRequest{
+			Method: "GetTransaction",
+			Params: []interface{}{txid},
+		})
 	}
 
-	result, err := wm.WalletClient.Call("GetTransaction", request)
+	results, err := wm.WalletClient.BatchCall(requests)
 	if err != nil {
 		return nil, err
 	}
 
-	return newTxByCore(result), nil
+	for i, r := range results {
+		if r.Error != nil {
+			wm.Log.Std.Debug("get transaction: %s failed, unexpected error: %v", txids[i], r.Error)
+			continue
+		}
+		trxs[txids[i]] = newTxByCore(r.Result)
+	}
+
+	return trxs, nil
 }
 
 //GetTxOut 获取交易单输出信息，用于追溯交易单输入源头
@@ -1079,8 +1248,8 @@ func (bs *FIIIBlockScanner) GetBalanceByAddress(address ...string) ([]*openwalle
 
 //getBalanceByExplorer 获取地址余额
 func (wm *WalletManager) getBalanceCalUnspent(address ...string) ([]*openwallet.Balance, error) {
-	//强制6个确认
-	utxos, err := wm.ListUnspent(0, address...)
+	//余额只统计确认数不少于balanceMinConfirmations的utxo
+	utxos, err := wm.ListUnspent(wm.Config.BalanceMinConfirmations, address...)
 	if err != nil {
 		return nil, err
 	}
@@ -1146,6 +1315,15 @@ func (wm *WalletManager) calculateUnspent(utxos []*Unspent) map[string]*openwall
 
 }
 
+//CloseBlockScanner 关闭扫描器和本地区块链数据库
+func (bs *FIIIBlockScanner) CloseBlockScanner() error {
+	err := bs.BlockScannerBase.CloseBlockScanner()
+	if err != nil {
+		return err
+	}
+	return bs.closeBlockchainDB()
+}
+
 //SupportBlockchainDAI 支持外部设置区块链数据访问接口
 //@optional
 func (bs *FIIIBlockScanner) SupportBlockchainDAI() bool {
@@ -0,0 +1,322 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"sort"
+)
+
+const (
+	CoinSelectSmallestFirst  = "smallest_first"   //从小到大累加utxo
+	CoinSelectLargestFirst   = "largest_first"    //从大到小累加utxo
+	CoinSelectBranchAndBound = "branch_and_bound" //分支定界，寻找无需找零的组合
+	CoinSelectSingleAddress  = "single_address"   //只使用同一地址的utxo，避免关联多个地址
+
+	//分支定界最大搜索次数
+	branchAndBoundMaxTries = 100000
+)
+
+//EstimateFeeFunc 根据输入数量和是否有找零输出计算手续费
+type EstimateFeeFunc func(inputs int, withChange bool) (decimal.Decimal, error)
+
+//CoinSelection utxo选择结果
+type CoinSelection struct {
+	Unspents []*Unspent      //使用的utxo
+	Balance  decimal.Decimal //使用的utxo总额
+	Fees     decimal.Decimal //实际支付的手续费
+}
+
+//CoinSelectParams utxo选择策略的公共参数
+type CoinSelectParams struct {
+	Decimals  int32 //币种精度，用于把utxo金额转换为数量
+	MaxInputs int   //最多使用的utxo数量，为0不限制
+}
+
+//CoinSelector utxo选择策略
+type CoinSelector interface {
+	//Select 选择足够支付target和手续费的utxo
+	Select(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc) (*CoinSelection, error)
+}
+
+//NewCoinSelector 根据名称创建utxo选择策略，名称为空时使用smallest_first
+func NewCoinSelector(name string, params CoinSelectParams) (CoinSelector, error) {
+	switch name {
+	case "", CoinSelectSmallestFirst:
+		return &SmallestFirstSelector{params}, nil
+	case CoinSelectLargestFirst:
+		return &LargestFirstSelector{params}, nil
+	case CoinSelectBranchAndBound:
+		return &BranchAndBoundSelector{CoinSelectParams: params, Fallback: &LargestFirstSelector{params}}, nil
+	case CoinSelectSingleAddress:
+		return &SingleAddressSelector{params}, nil
+	default:
+		return nil, fmt.Errorf("unknown coin selector: %s", name)
+	}
+}
+
+//SmallestFirstSelector 从小到大累加utxo
+type SmallestFirstSelector struct {
+	CoinSelectParams
+}
+
+//Select 选择utxo
+func (s *SmallestFirstSelector) Select(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc) (*CoinSelection, error) {
+	return accumulateSelect(sortUnspents(unspents, true), target, estimateFee, s.CoinSelectParams)
+}
+
+//LargestFirstSelector 从大到小累加utxo，使用最少的输入
+type LargestFirstSelector struct {
+	CoinSelectParams
+}
+
+//Select 选择utxo
+func (s *LargestFirstSelector) Select(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc) (*CoinSelection, error) {
+	return accumulateSelect(sortUnspents(unspents, false), target, estimateFee, s.CoinSelectParams)
+}
+
+//BranchAndBoundSelector 分支定界，寻找总额刚好覆盖target和手续费的组合，不产生找零。
+//多出的部分不超过找零输出的手续费，直接作为手续费支付。
+type BranchAndBoundSelector struct {
+	CoinSelectParams
+	Fallback CoinSelector //找不到组合时使用的策略，为nil则返回错误
+}
+
+//Select 选择utxo
+func (s *BranchAndBoundSelector) Select(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc) (*CoinSelection, error) {
+
+	var (
+		values   = sortUnspents(unspents, false)
+		amounts  = make([]decimal.Decimal, len(values))
+		remain   = make([]decimal.Decimal, len(values)+1)
+		selected = make([]bool, len(values))
+		best     []bool
+		bestSum  decimal.Decimal
+		tries    = 0
+		err      error
+	)
+
+	for i, u := range values {
+		amounts[i] = unspentAmount(u, s.Decimals)
+	}
+	//remain[i] 为第i个及之后utxo的总额
+	remain[len(values)] = decimal.Zero
+	for i := len(values) - 1; i >= 0; i-- {
+		remain[i] = remain[i+1].Add(amounts[i])
+	}
+
+	var search func(depth, count int, sum decimal.Decimal) bool
+	search = func(depth, count int, sum decimal.Decimal) bool {
+		tries++
+		if tries > branchAndBoundMaxTries {
+			return true
+		}
+
+		if count > 0 {
+			noChangeFees, feeErr := estimateFee(count, false)
+			if feeErr != nil {
+				err = feeErr
+				return true
+			}
+			changeFees, feeErr := estimateFee(count, true)
+			if feeErr != nil {
+				err = feeErr
+				return true
+			}
+			lower := target.Add(noChangeFees)
+			upper := target.Add(changeFees)
+
+			if sum.GreaterThan(upper) {
+				return false
+			}
+			if sum.GreaterThanOrEqual(lower) {
+				if best == nil || sum.LessThan(bestSum) {
+					best = make([]bool, len(selected))
+					copy(best, selected)
+					bestSum = sum
+				}
+				//刚好等于时不需要继续搜索
+				return sum.Equal(lower)
+			}
+		}
+
+		if depth >= len(values) || sum.Add(remain[depth]).LessThan(target) {
+			return false
+		}
+
+		//达到最大输入数量后不再加入utxo
+		if s.MaxInputs > 0 && count >= s.MaxInputs {
+			return false
+		}
+
+		selected[depth] = true
+		if search(depth+1, count+1, sum.Add(amounts[depth])) {
+			return true
+		}
+		selected[depth] = false
+		return search(depth+1, count, sum)
+	}
+
+	search(0, 0, decimal.Zero)
+	if err != nil {
+		return nil, err
+	}
+
+	if best == nil {
+		if s.Fallback != nil {
+			return s.Fallback.Select(unspents, target, estimateFee)
+		}
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "can not find utxo combination without change")
+	}
+
+	selection := &CoinSelection{
+		Unspents: make([]*Unspent, 0),
+		Balance:  bestSum,
+		Fees:     bestSum.Sub(target),
+	}
+	for i, u := range values {
+		if best[i] {
+			selection.Unspents = append(selection.Unspents, u)
+		}
+	}
+
+	return selection, nil
+}
+
+//SingleAddressSelector 只使用同一个地址的utxo，避免一笔交易关联账户的多个地址。
+//优先选择需要输入数量最少的地址。
+type SingleAddressSelector struct {
+	CoinSelectParams
+}
+
+//Select 选择utxo
+func (s *SingleAddressSelector) Select(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc) (*CoinSelection, error) {
+
+	var (
+		addresses = make([]string, 0)
+		groups    = make(map[string][]*Unspent)
+		best      *CoinSelection
+		lastErr   error
+	)
+
+	for _, u := range unspents {
+		if _, exist := groups[u.Address]; !exist {
+			addresses = append(addresses, u.Address)
+		}
+		groups[u.Address] = append(groups[u.Address], u)
+	}
+
+	for _, addr := range addresses {
+		selection, err := accumulateSelect(sortUnspents(groups[addr], true), target, estimateFee, s.CoinSelectParams)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil ||
+			len(selection.Unspents) < len(best.Unspents) ||
+			(len(selection.Unspents) == len(best.Unspents) && selection.Balance.LessThan(best.Balance)) {
+			best = selection
+		}
+	}
+
+	if best == nil {
+		if lastErr == nil {
+			lastErr = openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance of any single address is not enough")
+		}
+		return nil, lastErr
+	}
+
+	return best, nil
+}
+
+//accumulateSelect 按顺序累加utxo直到足够支付target和手续费。
+//超过最大输入数量时去掉已选中金额最小的utxo，从小到大累加时相当于保留最大的MaxInputs个继续累加。
+func accumulateSelect(unspents []*Unspent, target decimal.Decimal, estimateFee EstimateFeeFunc, params CoinSelectParams) (*CoinSelection, error) {
+
+	var (
+		usedUTXO = make([]*Unspent, 0)
+		balance  = decimal.Zero
+		limited  = false
+	)
+
+	for _, u := range unspents {
+		usedUTXO = append(usedUTXO, u)
+		balance = balance.Add(unspentAmount(u, params.Decimals))
+
+		if params.MaxInputs > 0 && len(usedUTXO) > params.MaxInputs {
+			smallest := 0
+			for i, used := range usedUTXO {
+				if used.Amount < usedUTXO[smallest].Amount {
+					smallest = i
+				}
+			}
+			balance = balance.Sub(unspentAmount(usedUTXO[smallest], params.Decimals))
+			usedUTXO = append(usedUTXO[:smallest], usedUTXO[smallest+1:]...)
+			limited = true
+		}
+
+		if balance.LessThan(target) {
+			continue
+		}
+
+		fees, err := estimateFee(len(usedUTXO), true)
+		if err != nil {
+			return nil, err
+		}
+
+		if balance.GreaterThanOrEqual(target.Add(fees)) {
+			return &CoinSelection{
+				Unspents: usedUTXO,
+				Balance:  balance,
+				Fees:     fees,
+			}, nil
+		}
+	}
+
+	if limited {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "The balance: %s of max inputs: %d is not enough! ", balance.StringFixed(params.Decimals), params.MaxInputs)
+	}
+	return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "The balance: %s is not enough! ", balance.StringFixed(params.Decimals))
+}
+
+//sortUnspents 过滤不可花费的utxo，并按金额排序
+func sortUnspents(unspents []*Unspent, ascending bool) []*Unspent {
+	values := make([]*Unspent, 0, len(unspents))
+	for _, u := range unspents {
+		if u.Spendable {
+			values = append(values, u)
+		}
+	}
+
+	sort.Stable(UnspentSort{values, func(a, b *Unspent) int {
+		if a.Amount == b.Amount {
+			return 0
+		}
+		if (a.Amount > b.Amount) == ascending {
+			return 1
+		}
+		return -1
+	}})
+
+	return values
+}
+
+func unspentAmount(u *Unspent, decimals int32) decimal.Decimal {
+	return common.IntToDecimals(int64(u.Amount), decimals)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+//testUnspents 生成测试utxo，amounts为最小单位
+func testUnspents(address string, amounts ...uint64) []*Unspent {
+	utxos := make([]*Unspent, 0)
+	for i, a := range amounts {
+		utxos = append(utxos, &Unspent{
+			TxID:      fmt.Sprintf("%064x", i),
+			Vout:      uint64(i),
+			Address:   address,
+			Amount:    a,
+			Spendable: true,
+		})
+	}
+	return utxos
+}
+
+//testSelectParams 测试使用FIII的精度，不限制输入数量
+var testSelectParams = CoinSelectParams{Decimals: Decimals}
+
+//testEstimateFee 每个输入0.001，每个输出0.0005，固定1个接收输出
+func testEstimateFee(inputs int, withChange bool) (decimal.Decimal, error) {
+	outputs := int64(1)
+	if withChange {
+		outputs++
+	}
+	fees := decimal.New(int64(inputs), -3).Add(decimal.New(outputs*5, -4))
+	return fees, nil
+}
+
+func TestSmallestFirstSelector(t *testing.T) {
+	utxos := testUnspents("addr1", 500000000, 10000000, 20000000, 30000000)
+	target, _ := decimal.NewFromString("0.25")
+
+	selection, err := (&SmallestFirstSelector{testSelectParams}).Select(utxos, target, testEstimateFee)
+	if err != nil {
+		t.Fatalf("Select failed unexpected error: %v\n", err)
+	}
+
+	//0.1 + 0.2 = 0.3 >= 0.25 + 0.003
+	if len(selection.Unspents) != 2 {
+		t.Errorf("selected inputs: %d, expected: 2", len(selection.Unspents))
+	}
+	if selection.Unspents[0].Amount != 10000000 {
+		t.Errorf("smallest utxo should be selected first")
+	}
+	t.Logf("balance: %s, fees: %s", selection.Balance, selection.Fees)
+}
+
+func TestLargestFirstSelector(t *testing.T) {
+	utxos := testUnspents("addr1", 10000000, 20000000, 500000000, 30000000)
+	target, _ := decimal.NewFromString("0.25")
+
+	selection, err := (&LargestFirstSelector{testSelectParams}).Select(utxos, target, testEstimateFee)
+	if err != nil {
+		t.Fatalf("Select failed unexpected error: %v\n", err)
+	}
+
+	if len(selection.Unspents) != 1 || selection.Unspents[0].Amount != 500000000 {
+		t.Errorf("largest utxo should be selected only")
+	}
+}
+
+func TestBranchAndBoundSelector(t *testing.T) {
+	//0.2 + 0.0525 = 0.25 + 2个输入手续费0.002 + 1个输出手续费0.0005
+	utxos := testUnspents("addr1", 100000000, 20000000, 5250000, 70000000, 1000000)
+	target, _ := decimal.NewFromString("0.25")
+
+	selector := &BranchAndBoundSelector{CoinSelectParams: testSelectParams}
+	selection, err := selector.Select(utxos, target, testEstimateFee)
+	if err != nil {
+		t.Fatalf("Select failed unexpected error: %v\n", err)
+	}
+
+	noChangeFees, _ := testEstimateFee(len(selection.Unspents), false)
+	changeFees, _ := testEstimateFee(len(selection.Unspents), true)
+	if selection.Balance.LessThan(target.Add(noChangeFees)) || selection.Balance.GreaterThan(target.Add(changeFees)) {
+		t.Errorf("selection balance: %s is not in range without change", selection.Balance)
+	}
+	if !selection.Balance.Sub(selection.Fees).Equal(target) {
+		t.Errorf("the excess should be paid as fees, balance: %s, fees: %s", selection.Balance, selection.Fees)
+	}
+	t.Logf("inputs: %d, balance: %s, fees: %s", len(selection.Unspents), selection.Balance, selection.Fees)
+
+	//没有刚好的组合
+	utxos = testUnspents("addr1", 100000000)
+	_, err = selector.Select(utxos, target, testEstimateFee)
+	if err == nil {
+		t.Errorf("selection without fallback should be failed")
+	}
+
+	selector.Fallback = &LargestFirstSelector{testSelectParams}
+	selection, err = selector.Select(utxos, target, testEstimateFee)
+	if err != nil {
+		t.Fatalf("Select with fallback failed unexpected error: %v\n", err)
+	}
+	if len(selection.Unspents) != 1 {
+		t.Errorf("fallback selector should be used")
+	}
+}
+
+func TestSingleAddressSelector(t *testing.T) {
+	utxos := testUnspents("addr1", 10000000, 10000000, 10000000)
+	utxos = append(utxos, testUnspents("addr2", 15000000, 15000000)...)
+	utxos = append(utxos, testUnspents("addr3", 20000000)...)
+	target, _ := decimal.NewFromString("0.25")
+
+	selection, err := (&SingleAddressSelector{testSelectParams}).Select(utxos, target, testEstimateFee)
+	if err != nil {
+		t.Fatalf("Select failed unexpected error: %v\n", err)
+	}
+
+	for _, u := range selection.Unspents {
+		if u.Address != "addr2" {
+			t.Errorf("selected utxo address: %s, expected: addr2", u.Address)
+		}
+	}
+
+	target, _ = decimal.NewFromString("0.4")
+	_, err = (&SingleAddressSelector{testSelectParams}).Select(utxos, target, testEstimateFee)
+	if err == nil {
+		t.Errorf("selection should be failed when no single address is enough")
+	}
+}
+
+func TestNewCoinSelector(t *testing.T) {
+	for _, name := range []string{"", CoinSelectSmallestFirst, CoinSelectLargestFirst, CoinSelectBranchAndBound, CoinSelectSingleAddress} {
+		_, err := NewCoinSelector(name, testSelectParams)
+		if err != nil {
+			t.Errorf("NewCoinSelector[%s] failed unexpected error: %v\n", name, err)
+		}
+	}
+
+	_, err := NewCoinSelector("unknown", testSelectParams)
+	if err == nil {
+		t.Errorf("unknown coin selector should be rejected")
+	}
+}
+
+func TestCoinSelector_MaxInputs(t *testing.T) {
+	target, _ := decimal.NewFromString("0.25")
+	params := CoinSelectParams{Decimals: Decimals, MaxInputs: 3}
+
+	//不限制时从小到大需要11个输入，限制3个时保留最大的utxo继续累加
+	utxos := testUnspents("addr1", 1000000, 1000000, 1000000, 1000000, 1000000, 1000000, 1000000, 1000000, 1000000, 1000000, 20000000, 20000000)
+	selection, err := (&SmallestFirstSelector{params}).Select(utxos, target, testEstimateFee)
+	if err != nil || len(selection.Unspents) > 3 {
+		t.Errorf("smallest first selection: %+v over max inputs, error: %v", selection, err)
+	} else if expected, _ := decimal.NewFromString("0.41"); !selection.Balance.Equal(expected) {
+		t.Errorf("selection balance: %s, expected: %s", selection.Balance, expected)
+	}
+
+	//最大的1个utxo也不够时返回错误
+	_, err = (&LargestFirstSelector{CoinSelectParams{Decimals: Decimals, MaxInputs: 1}}).Select(testUnspents("addr1", 20000000, 20000000), target, testEstimateFee)
+	if err == nil {
+		t.Errorf("largest first selection should be failed when max inputs is not enough")
+	}
+
+	//0.1 + 0.1 + 0.0535 = 0.25 + 3个输入手续费0.003 + 1个输出手续费0.0005，需要3个输入
+	utxos = testUnspents("addr1", 10000000, 10000000, 5350000)
+	if _, err = (&BranchAndBoundSelector{CoinSelectParams: testSelectParams}).Select(utxos, target, testEstimateFee); err != nil {
+		t.Errorf("branch and bound selection failed unexpected error: %v", err)
+	}
+	if _, err = (&BranchAndBoundSelector{CoinSelectParams: CoinSelectParams{Decimals: Decimals, MaxInputs: 2}}).Select(utxos, target, testEstimateFee); err == nil {
+		t.Errorf("branch and bound selection should be failed when the combination is over max inputs")
+	}
+}
+
+func TestCoinSelector_Decimals(t *testing.T) {
+	//utxo金额按选择策略的精度转换
+	selection, err := (&LargestFirstSelector{CoinSelectParams{Decimals: 4}}).Select(testUnspents("addr1", 30000), decimal.New(2, 0), testEstimateFee)
+	if err != nil || !selection.Balance.Equal(decimal.New(3, 0)) {
+		t.Errorf("selection: %+v, error: %v, expected balance: 3", selection, err)
+	}
+}
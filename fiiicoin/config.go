@@ -18,8 +18,16 @@ package fiiicoin
 import (
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/common/file"
+	"github.com/shopspring/decimal"
 	"path/filepath"
 	"strings"
+	"time"
+)
+
+const (
+	ChangePolicyInput   = "input"   //找零到第一个输入地址
+	ChangePolicyAccount = "account" //找零到账户专用的找零地址
+	ChangePolicyFresh   = "fresh"   //找零到未使用过的找零地址
 )
 
 const (
@@ -30,9 +38,82 @@ const (
 	//默认配置内容
 	defaultConfig = `
 
-# RPC api url
+# RPC api url, separate multiple nodes by comma for failover
 serverAPI = ""
 isTestNet = false
+# UTXO selection strategy: smallest_first, largest_first, branch_and_bound, single_address
+coinSelector = "smallest_first"
+# split mode when inputs exceed the max inputs: payment, consolidate
+splitMode = "payment"
+# change address policy: input, account, fresh
+changePolicy = "input"
+# the minimum confirmations of utxo to build a transaction
+minConfirmations = 6
+# the minimum confirmations of utxo to build a summary transaction
+summaryMinConfirmations = 6
+# the minimum confirmations of utxo to calculate balance
+balanceMinConfirmations = 0
+# allow to spend the unconfirmed change of our own transactions
+allowUnconfirmedChange = false
+# the minimum amount of an output, the change below it is paid as fees
+dustLimit = "0.00001"
+# the floor and ceiling of fee rate per KB, 0 means no limit
+minFeeRate = "0"
+maxFeeRate = "0"
+# the fee rate per KB used when EstimateSmartFee of node failed, 0 means return the error
+fallbackFeeRate = "0"
+# the timeout seconds of each RPC request, 0 means no timeout
+rpcTimeout = 30
+# the max retries of RPC request when the transport failed or node response 5xx
+rpcMaxRetries = 3
+# the milliseconds to wait before the first retry, doubled for each retry
+rpcRetryBackoff = 500
+# the max number of requests in a json-rpc batch, 0 means no limit
+rpcBatchSize = 100
+# the basic auth credentials of the node or its reverse proxy
+rpcUsername = ""
+rpcPassword = ""
+# the bearer token of the node or its reverse proxy, can not be used with basic auth
+rpcBearerToken = ""
+# the PEM CA bundle to verify the node certificate, empty means the system roots
+rpcCAFile = ""
+# the PEM client certificate and key for mutual TLS
+rpcCertFile = ""
+rpcKeyFile = ""
+# skip verifying the node certificate, only for test
+rpcInsecureSkipVerify = false
+# the max json-rpc calls per second to each node, a batch counts its calls, 0 means no limit
+rpcRateLimit = 0
+# the burst calls allowed above rpcRateLimit, 0 means the same as rpcRateLimit
+rpcRateBurst = 0
+# the max concurrent requests to each node, 0 means no limit
+rpcMaxInFlight = 0
+# the max requests waiting for rpcRateLimit or rpcMaxInFlight, more requests are rejected, 0 means no limit
+rpcMaxQueued = 0
+# append every json-rpc call and response to this file, empty means no recording
+rpcRecordFile = ""
+# replay the calls recorded in this file instead of connecting the node, only for debugging
+rpcReplayFile = ""
+# the number of nodes must return the same block count and hash before scanning, 0 or 1 means no cross-check
+nodeQuorum = 0
+# the node is unhealthy when its local block height is behind the network more than this
+nodeMaxBlockLag = 3
+# the seconds between node health checks, 0 means no health check
+nodeHealthCheckInterval = 60
+# the max seconds of the node reported time offset (TimeOffset in milliseconds, either direction), 0 means no check
+nodeMaxTimeOffset = 1800
+# pause scanning and refuse broadcasting when the node is not running, has no peers,
+# lags the network more than nodeMaxBlockLag or its time offset exceeds nodeMaxTimeOffset
+nodeReadyCheck = true
+# the max blocks to walk back for the common ancestor when the chain forks, deeper forks stop the scanner
+maxReorgDepth = 100
+# the number of recent blocks whose transaction lists are kept in the local db, 0 means keep all
+blockTxsCacheSize = 1000
+# notify extracted transactions again when their confirmations reach these milestones, the last one is final,
+# transactions dropped by a fork are notified with failed status, empty means no tracking
+confirmMilestones = "1,6,12"
+# the number of blocks fetched concurrently ahead when the scanner is catching up, 0 or 1 means one by one
+blockPrefetchSize = 0
 `
 )
 
@@ -45,7 +126,7 @@ type WalletConfig struct {
 	//配置文件名
 	configFileName string
 	//区块链数据文件
-	//BlockchainFile string
+	BlockchainFile string
 	//本地数据库文件路径
 	dbPath string
 	//钱包服务API
@@ -60,6 +141,68 @@ type WalletConfig struct {
 	MaxTxInputs int
 	//数据目录
 	DataDir string
+	//utxo选择策略
+	CoinSelector string
+	//输入超过最大数量时的拆分模式
+	SplitMode string
+	//找零地址策略
+	ChangePolicy string
+	//构建交易单使用的utxo最少确认数
+	MinConfirmations uint64
+	//汇总交易单使用的utxo最少确认数
+	SummaryMinConfirmations uint64
+	//计算余额的utxo最少确认数
+	BalanceMinConfirmations uint64
+	//是否允许花费自己交易单未确认的找零
+	AllowUnconfirmedChange bool
+	//粉尘限制，输出低于该数量拒绝创建交易单
+	DustLimit decimal.Decimal
+	//最低每KB费率，为0不限制
+	MinFeeRate decimal.Decimal
+	//最高每KB费率，为0不限制
+	MaxFeeRate decimal.Decimal
+	//节点预估费率失败时使用的每KB费率，为0则返回错误
+	FallbackFeeRate decimal.Decimal
+	//RPC请求超时时间
+	RPCTimeout time.Duration
+	//RPC请求的最大重试次数
+	RPCMaxRetries int
+	//RPC请求第一次重试前的等待时间
+	RPCRetryBackoff time.Duration
+	//每次批量请求的最大请求数
+	RPCBatchSize int
+	//节点连接的认证和TLS配置
+	RPCAuth *ClientAuth
+	//每个节点每秒的最大请求数，0不限制
+	RPCRateLimit float64
+	//令牌桶容量，允许的突发请求数
+	RPCRateBurst int
+	//每个节点同时进行的最大请求数，0不限制
+	RPCMaxInFlight int
+	//每个节点等待中的最大请求数，超过时拒绝请求，0不限制
+	RPCMaxQueued int
+	//记录节点请求和响应的文件，为空不记录
+	RPCRecordFile string
+	//回放的记录文件，不为空时不连接节点
+	RPCReplayFile string
+	//需要结果一致的节点数量
+	NodeQuorum int
+	//节点本地区块高度落后网络的最大区块数
+	NodeMaxBlockLag uint64
+	//节点健康检查的间隔
+	NodeHealthCheckInterval time.Duration
+	//节点报告的时间偏差TimeOffset（毫秒，取绝对值）允许的最大值
+	NodeMaxTimeOffset time.Duration
+	//扫块和广播交易单前是否检查节点已就绪
+	NodeReadyCheck bool
+	//分叉时最多回退的区块数量
+	MaxReorgDepth uint64
+	//本地保存交易单列表的区块数量，0不删除
+	BlockTxsCacheSize uint64
+	//再次通知交易单的确认数节点，最后一个为最终确认数
+	ConfirmMilestones []uint64
+	//追块时并发预取的区块数量
+	BlockPrefetchSize int
 }
 
 func NewConfig(symbol string) *WalletConfig {
@@ -74,13 +217,44 @@ func NewConfig(symbol string) *WalletConfig {
 	//配置文件名
 	c.configFileName = c.Symbol + ".ini"
 	//区块链数据文件
-	//c.BlockchainFile = "blockchain.db"
+	c.BlockchainFile = "blockchain.db"
 	//本地数据库文件路径
 	c.dbPath = filepath.Join("data", strings.ToLower(c.Symbol), "db")
 	//钱包服务API
 	c.ServerAPI = ""
 	//最大的输入数量
 	c.MaxTxInputs = 50
+	//utxo选择策略
+	c.CoinSelector = CoinSelectSmallestFirst
+	//输入超过最大数量时的拆分模式
+	c.SplitMode = SplitModePayment
+	//找零地址策略
+	c.ChangePolicy = ChangePolicyInput
+	//utxo最少确认数
+	c.MinConfirmations = 6
+	c.SummaryMinConfirmations = 6
+	c.BalanceMinConfirmations = 0
+	c.AllowUnconfirmedChange = false
+	//粉尘限制
+	c.DustLimit = decimal.New(1, -5)
+	//费率限制
+	c.MinFeeRate = decimal.Zero
+	c.MaxFeeRate = decimal.Zero
+	c.FallbackFeeRate = decimal.Zero
+	//RPC请求重试策略
+	c.RPCTimeout = defaultRPCTimeout
+	c.RPCMaxRetries = defaultRPCMaxRetries
+	c.RPCRetryBackoff = defaultRPCRetryBackoff
+	c.RPCBatchSize = defaultRPCBatchSize
+	//节点池
+	c.NodeQuorum = 0
+	c.NodeMaxBlockLag = defaultNodeMaxBlockLag
+	c.NodeHealthCheckInterval = defaultNodeHealthCheckInterval
+	c.NodeMaxTimeOffset = defaultNodeMaxTimeOffset
+	c.NodeReadyCheck = true
+	c.MaxReorgDepth = defaultMaxReorgDepth
+	c.BlockTxsCacheSize = defaultBlockTxsCacheSize
+	c.ConfirmMilestones, _ = ParseConfirmMilestones(defaultConfirmMilestones)
 
 	//创建目录
 	//file.MkdirAll(c.dbPath)
@@ -16,9 +16,12 @@
 package fiiicoin
 
 import (
+	"fmt"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"time"
 )
 
 //CurveType 曲线类型
@@ -68,14 +71,133 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 
 	wm.Config.ServerAPI = c.String("serverAPI")
 	wm.Config.IsTestNet, _ = c.Bool("isTestNet")
-	wm.WalletClient = NewClient(wm.Config.ServerAPI, false)
+	wm.Config.RPCTimeout = time.Duration(c.DefaultInt64("rpcTimeout", 30)) * time.Second
+	wm.Config.RPCMaxRetries = c.DefaultInt("rpcMaxRetries", defaultRPCMaxRetries)
+	wm.Config.RPCRetryBackoff = time.Duration(c.DefaultInt64("rpcRetryBackoff", 500)) * time.Millisecond
+	wm.Config.RPCBatchSize = c.DefaultInt("rpcBatchSize", defaultRPCBatchSize)
+	if wm.Config.RPCTimeout < 0 || wm.Config.RPCMaxRetries < 0 || wm.Config.RPCRetryBackoff < 0 || wm.Config.RPCBatchSize < 0 {
+		return fmt.Errorf("rpcTimeout, rpcMaxRetries, rpcRetryBackoff and rpcBatchSize can not be negative")
+	}
+	wm.Config.RPCAuth = &ClientAuth{
+		Username:           c.String("rpcUsername"),
+		Password:           c.String("rpcPassword"),
+		BearerToken:        c.String("rpcBearerToken"),
+		CAFile:             c.String("rpcCAFile"),
+		CertFile:           c.String("rpcCertFile"),
+		KeyFile:            c.String("rpcKeyFile"),
+		InsecureSkipVerify: c.DefaultBool("rpcInsecureSkipVerify", false),
+	}
+	wm.Config.RPCRateLimit = c.DefaultFloat("rpcRateLimit", 0)
+	wm.Config.RPCRateBurst = c.DefaultInt("rpcRateBurst", 0)
+	wm.Config.RPCMaxInFlight = c.DefaultInt("rpcMaxInFlight", 0)
+	wm.Config.RPCMaxQueued = c.DefaultInt("rpcMaxQueued", 0)
+	if wm.Config.RPCRateLimit < 0 || wm.Config.RPCRateBurst < 0 || wm.Config.RPCMaxInFlight < 0 || wm.Config.RPCMaxQueued < 0 {
+		return fmt.Errorf("rpcRateLimit, rpcRateBurst, rpcMaxInFlight and rpcMaxQueued can not be negative")
+	}
+	wm.Config.RPCRecordFile = c.String("rpcRecordFile")
+	wm.Config.RPCReplayFile = c.String("rpcReplayFile")
+	wm.Config.NodeQuorum = c.DefaultInt("nodeQuorum", 0)
+	wm.Config.NodeMaxBlockLag = uint64(c.DefaultInt64("nodeMaxBlockLag", defaultNodeMaxBlockLag))
+	wm.Config.NodeHealthCheckInterval = time.Duration(c.DefaultInt64("nodeHealthCheckInterval", 60)) * time.Second
+	wm.Config.NodeMaxTimeOffset = time.Duration(c.DefaultInt64("nodeMaxTimeOffset", 1800)) * time.Second
+	wm.Config.NodeReadyCheck = c.DefaultBool("nodeReadyCheck", true)
+	wm.Config.MaxReorgDepth = uint64(c.DefaultInt64("maxReorgDepth", defaultMaxReorgDepth))
+	if wm.Config.MaxReorgDepth == 0 {
+		return fmt.Errorf("maxReorgDepth should be greater than 0")
+	}
+	wm.Blockscanner.MaxReorgDepth = wm.Config.MaxReorgDepth
+	wm.Config.BlockTxsCacheSize = uint64(c.DefaultInt64("blockTxsCacheSize", defaultBlockTxsCacheSize))
+	confirmMilestones, parseErr := ParseConfirmMilestones(c.DefaultString("confirmMilestones", defaultConfirmMilestones))
+	if parseErr != nil {
+		return parseErr
+	}
+	wm.Config.ConfirmMilestones = confirmMilestones
+	wm.Config.BlockPrefetchSize = c.DefaultInt("blockPrefetchSize", 0)
+	if wm.Config.BlockPrefetchSize < 0 {
+		return fmt.Errorf("blockPrefetchSize can not be negative")
+	}
+	wm.Blockscanner.PrefetchBlocks = wm.Config.BlockPrefetchSize
+	serverAPIs := ParseServerAPIs(wm.Config.ServerAPI)
+	if wm.Config.NodeQuorum > len(serverAPIs) {
+		return fmt.Errorf("nodeQuorum: %d is greater than the number of nodes: %d", wm.Config.NodeQuorum, len(serverAPIs))
+	}
+	pool := NewClientPool(serverAPIs, false)
+	pool.Quorum = wm.Config.NodeQuorum
+	pool.MaxBlockLag = wm.Config.NodeMaxBlockLag
+	pool.HealthCheckInterval = wm.Config.NodeHealthCheckInterval
+	pool.MaxTimeOffset = wm.Config.NodeMaxTimeOffset
+	wm.WalletClient = pool
+	for _, client := range pool.Clients() {
+		client.Timeout = wm.Config.RPCTimeout
+		client.MaxRetries = wm.Config.RPCMaxRetries
+		client.RetryBackoff = wm.Config.RPCRetryBackoff
+		client.MaxBatchSize = wm.Config.RPCBatchSize
+		client.SetRateLimit(wm.Config.RPCRateLimit, wm.Config.RPCRateBurst, wm.Config.RPCMaxInFlight, wm.Config.RPCMaxQueued)
+		if err := client.SetAuth(wm.Config.RPCAuth); err != nil {
+			return err
+		}
+	}
+	if err := wm.setupRecording(pool); err != nil {
+		return err
+	}
 	wm.Config.DataDir = c.String("dataDir")
+	wm.Config.CoinSelector = c.DefaultString("coinSelector", CoinSelectSmallestFirst)
+	if _, err := NewCoinSelector(wm.Config.CoinSelector, CoinSelectParams{}); err != nil {
+		return err
+	}
+	wm.Config.SplitMode = c.DefaultString("splitMode", SplitModePayment)
+	switch wm.Config.SplitMode {
+	case SplitModePayment, SplitModeConsolidate:
+	default:
+		return fmt.Errorf("unknown split mode: %s", wm.Config.SplitMode)
+	}
+	wm.Config.ChangePolicy = c.DefaultString("changePolicy", ChangePolicyInput)
+	switch wm.Config.ChangePolicy {
+	case ChangePolicyInput, ChangePolicyAccount, ChangePolicyFresh:
+	default:
+		return fmt.Errorf("unknown change policy: %s", wm.Config.ChangePolicy)
+	}
+	minConfirmations := c.DefaultInt64("minConfirmations", 6)
+	summaryMinConfirmations := c.DefaultInt64("summaryMinConfirmations", 6)
+	balanceMinConfirmations := c.DefaultInt64("balanceMinConfirmations", 0)
+	if minConfirmations < 0 || summaryMinConfirmations < 0 || balanceMinConfirmations < 0 {
+		return fmt.Errorf("minConfirmations, summaryMinConfirmations and balanceMinConfirmations can not be negative")
+	}
+	wm.Config.MinConfirmations = uint64(minConfirmations)
+	wm.Config.SummaryMinConfirmations = uint64(summaryMinConfirmations)
+	wm.Config.BalanceMinConfirmations = uint64(balanceMinConfirmations)
+	wm.Config.AllowUnconfirmedChange = c.DefaultBool("allowUnconfirmedChange", false)
+	var err error
+	if wm.Config.DustLimit, err = loadConfigDecimal(c, "dustLimit", "0.00001"); err != nil {
+		return err
+	}
+	if wm.Config.MinFeeRate, err = loadConfigDecimal(c, "minFeeRate", "0"); err != nil {
+		return err
+	}
+	if wm.Config.MaxFeeRate, err = loadConfigDecimal(c, "maxFeeRate", "0"); err != nil {
+		return err
+	}
+	if wm.Config.FallbackFeeRate, err = loadConfigDecimal(c, "fallbackFeeRate", "0"); err != nil {
+		return err
+	}
+	if wm.Config.MaxFeeRate.GreaterThan(decimal.Zero) && wm.Config.MinFeeRate.GreaterThan(wm.Config.MaxFeeRate) {
+		return fmt.Errorf("minFeeRate: %s is greater than maxFeeRate: %s", wm.Config.MinFeeRate.String(), wm.Config.MaxFeeRate.String())
+	}
 
 	//数据文件夹
 	wm.Config.makeDataDir()
 	return nil
 }
 
+//loadConfigDecimal 读取非负数的配置
+func loadConfigDecimal(c config.Configer, key, def string) (decimal.Decimal, error) {
+	value, err := decimal.NewFromString(c.DefaultString(key, def))
+	if err != nil || value.LessThan(decimal.Zero) {
+		return decimal.Zero, fmt.Errorf("invalid %s: %s", key, c.String(key))
+	}
+	return value, nil
+}
+
 //InitAssetsConfig 初始化默认配置
 func (wm *WalletManager) InitAssetsConfig() (config.Configer, error) {
 	return config.NewConfigData("ini", []byte(wm.Config.DefaultConfig))
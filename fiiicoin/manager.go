@@ -16,6 +16,8 @@
 package fiiicoin
 
 import (
+	"context"
+	"fmt"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
@@ -29,12 +31,13 @@ const (
 type WalletManager struct {
 	openwallet.AssetsAdapterBase
 
-	WalletClient    *Client                       // 节点客户端
+	WalletClient    ClientInterface               // 节点客户端，通常为*ClientPool
 	Config          *WalletConfig                 //钱包管理配置
 	Blockscanner    *FIIIBlockScanner              //区块扫描器
 	Decoder         *AddressDecoder                //地址编码器
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
+	Recorder        *RPCRecorder                  //节点请求记录器，配置了rpcRecordFile时创建，可以设置Redact
 }
 
 func NewWalletManager() *WalletManager {
@@ -50,42 +53,14 @@ func NewWalletManager() *WalletManager {
 
 func (wm *WalletManager) GetAddressesByTag(tag string) ([]string, error) {
 
-	var (
-		addresses = make([]string, 0)
-	)
-
-	request := []interface{}{
-		tag,
-	}
-
-	result, err := wm.WalletClient.Call("GetAddressesByTag", request)
-	if err != nil {
-		return nil, err
-	}
-
-	array := result.Array()
-	for _, a := range array {
-		addresses = append(addresses, a.String())
-	}
-
-	return addresses, nil
+	return wm.NodeAPI().GetAddressesByTag(context.Background(), tag)
 
 }
 
 //AddWatchOnlyAddress 导入地址核心钱包
 func (wm *WalletManager) AddWatchOnlyAddress(publickey string) error {
 
-	request := []interface{}{
-		publickey,
-	}
-
-	_, err := wm.WalletClient.Call("AddWatchOnlyAddress", request)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return wm.NodeAPI().AddWatchOnlyAddress(context.Background(), publickey)
 
 }
 
@@ -96,14 +71,13 @@ func (wm *WalletManager) ExportAddresses() ([]string, error) {
 		addresses = make([]string, 0)
 	)
 
-	result, err := wm.WalletClient.Call("ExportAddresses", nil)
+	infos, err := wm.NodeAPI().ExportAddresses(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	array := gjson.Parse(result.String()).Array()
-	for _, a := range array {
-		addresses = append(addresses, a.Get("Id").String())
+	for _, a := range infos {
+		addresses = append(addresses, a.ID)
 	}
 
 	return addresses, nil
@@ -113,31 +87,18 @@ func (wm *WalletManager) ExportAddresses() ([]string, error) {
 // GetAccountByAddress
 func (wm *WalletManager) GetAccountByAddress(address string) (uint64, error) {
 
-	request := []interface{}{
-		address,
-	}
-
-	result, err := wm.WalletClient.Call("GetAccountByAddress", request)
+	account, err := wm.NodeAPI().GetAccountByAddress(context.Background(), address)
 	if err != nil {
 		return 0, err
 	}
 
-	balance := result.Get("Balance").Uint()
-
-	return balance, nil
+	return account.Balance, nil
 }
 
 //GetBlockChainInfo 获取钱包区块链信息
 func (wm *WalletManager) GetBlockChainInfo() (*BlockchainInfo, error) {
 
-	result, err := wm.WalletClient.Call("GetBlockChainInfo", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	blockchain := NewBlockchainInfo(result)
-
-	return blockchain, nil
+	return wm.NodeAPI().GetBlockChainInfo(context.Background())
 
 }
 
@@ -156,19 +117,41 @@ func (wm *WalletManager) ListUnspent(min uint64, addresses ...string) ([]*Unspen
 		err         error
 	)
 
+	//只有一页时直接查询
+	if max <= limit {
+		return wm.getListUnspentByCore(min, addresses...)
+	}
+
+	//多页地址通过批量请求查询
+	requests := make([]*BatchRequest, 0, step+1)
 	for i := 0; i <= step; i++ {
 		begin := i * limit
 		end := (i + 1) * limit
 		if end > max {
 			end = max
 		}
+		if begin >= end {
+			break
+		}
 
 		searchAddrs = addresses[begin:end]
 
-		pice, err = wm.getListUnspentByCore(min, searchAddrs...)
-		if err != nil {
-			return nil, err
+		requests = append(requests, &BatchRequest{
+			Method: "ListUnspent",
+			Params: listUnspentParams(min, searchAddrs...),
+		})
+	}
+
+	results, err := wm.WalletClient.BatchCall(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		if r.Error != nil {
+			return nil, r.Error
 		}
+		pice = newUnspents(r.Result)
 		utxo = append(utxo, pice...)
 	}
 	return utxo, nil
@@ -177,9 +160,16 @@ func (wm *WalletManager) ListUnspent(min uint64, addresses ...string) ([]*Unspen
 //getTransactionByCore 获取交易单
 func (wm *WalletManager) getListUnspentByCore(min uint64, addresses ...string) ([]*Unspent, error) {
 
-	var (
-		utxos = make([]*Unspent, 0)
-	)
+	result, err := wm.WalletClient.Call("ListUnspent", listUnspentParams(min, addresses...))
+	if err != nil {
+		return nil, err
+	}
+
+	return newUnspents(result), nil
+}
+
+//listUnspentParams ListUnspent的请求参数
+func listUnspentParams(min uint64, addresses ...string) []interface{} {
 
 	request := []interface{}{
 		min,
@@ -190,55 +180,82 @@ func (wm *WalletManager) getListUnspentByCore(min uint64, addresses ...string) (
 		request = append(request, addresses)
 	}
 
-	result, err := wm.WalletClient.Call("ListUnspent", request)
-	if err != nil {
-		return nil, err
-	}
+	return request
+}
+
+//newUnspents 解析ListUnspent的结果
+func newUnspents(result *gjson.Result) []*Unspent {
+
+	var (
+		utxos = make([]*Unspent, 0)
+	)
 
 	array := result.Array()
 	for _, a := range array {
 		utxos = append(utxos, NewUnspent(&a))
 	}
 
-	return utxos, nil
+	return utxos
 }
 
-//EstimateFee 预估手续费
+//EstimateFee 预估手续费，按签名后的交易单大小计算
 func (wm *WalletManager) EstimateFee(inputs, outputs int64, feeRate decimal.Decimal) (decimal.Decimal, error) {
 
-	var base int64 = 68
-
-	//TransactionHash数据量计算
-	//单位：Byte
-	//基础数据: 68 （整个个tx只要加一次）
-	//output: 101 （每个output都要加一次，如一个就是101，两个就是202）
-	//input: 262 （每个input都要加一次，如一个就是262，两个就是524）
-	//
-	//如果一个tx由一个input与两个output组成，那么它的数据量计算方法是：
-	//68 + 262 * 1 + 101 * 2
-	//计算公式如下：148 * 输入数额 + 34 * 输出数额 + 10
-	trx_bytes := decimal.New(inputs*262+outputs*101+base, 0)
+	//交易单大小见EstimateTxSize：txBaseSize + inputs * txSignedInputSize + outputs * txOutputSize
+	return wm.CalculateFee(EstimateTxSize(int(inputs), int(outputs)), feeRate), nil
+}
+
+//CalculateFee 根据交易单大小和每KB费率计算手续费
+func (wm *WalletManager) CalculateFee(size int, feeRate decimal.Decimal) decimal.Decimal {
+	trx_bytes := decimal.New(int64(size), 0)
 	trx_fee := trx_bytes.Div(decimal.New(1000, 0)).Mul(feeRate)
 	trx_fee = trx_fee.Round(wm.Decimal())
-	return trx_fee, nil
+	return trx_fee
 }
 
-//EstimateFeeRate 预估的没KB手续费率
+//EstimateFeeRate 预估的每KB手续费率，节点预估失败时使用配置的备用费率
 func (wm *WalletManager) EstimateFeeRate() (decimal.Decimal, error) {
 
-	feeRate := decimal.Zero
+	feeRate, err := wm.estimateSmartFeeRate()
+	if err != nil {
+		if wm.Config.FallbackFeeRate.GreaterThan(decimal.Zero) {
+			wm.Log.Warningf("EstimateSmartFee failed, use fallback fee rate: %s, unexpected error: %v", wm.Config.FallbackFeeRate.String(), err)
+			return wm.LimitFeeRate(wm.Config.FallbackFeeRate), nil
+		}
+		return decimal.Zero, err
+	}
+
+	return wm.LimitFeeRate(feeRate), nil
+}
+
+//estimateSmartFeeRate 节点预估的每KB手续费率
+func (wm *WalletManager) estimateSmartFeeRate() (decimal.Decimal, error) {
 
 	estimatesmartfee, err := wm.WalletClient.Call("EstimateSmartFee", nil)
 	if err != nil {
 		return decimal.Zero, err
 	}
 
-	feeRate, _ = decimal.NewFromString(estimatesmartfee.String())
+	feeRate, err := decimal.NewFromString(estimatesmartfee.String())
+	if err != nil || feeRate.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, fmt.Errorf("invalid smart fee: %s", estimatesmartfee.String())
+	}
 	feeRate = feeRate.Shift(-wm.Decimal())
 
 	return feeRate, nil
 }
 
+//LimitFeeRate 把费率限制在配置的最低和最高费率之间，为0表示不限制
+func (wm *WalletManager) LimitFeeRate(feeRate decimal.Decimal) decimal.Decimal {
+	if wm.Config.MinFeeRate.GreaterThan(decimal.Zero) && feeRate.LessThan(wm.Config.MinFeeRate) {
+		return wm.Config.MinFeeRate
+	}
+	if wm.Config.MaxFeeRate.GreaterThan(decimal.Zero) && feeRate.GreaterThan(wm.Config.MaxFeeRate) {
+		return wm.Config.MaxFeeRate
+	}
+	return feeRate
+}
+
 func (wm *WalletManager) CreateRawTransaction(senders []Unspent, receivers map[string]uint64, changeAddress string, feeRate uint64) (*gjson.Result, error) {
 
 	input := make([]interface{}, 0)
@@ -43,7 +43,9 @@ func testNewWalletManager() *WalletManager {
 	}
 	wm.LoadAssetsConfig(c)
 	//wm.ExplorerClient.Debug = false
-	wm.WalletClient.Debug = true
+	if pool, ok := wm.WalletClient.(*ClientPool); ok {
+		pool.SetDebug(true)
+	}
 	return wm
 }
 
@@ -117,4 +119,22 @@ func TestWalletManager_GetAccountByAddress(t *testing.T) {
 	}
 
 	t.Logf("balance = %d\n", b)
-}
\ No newline at end of file
+}
+func TestWalletManager_LoadAssetsConfigInvalid(t *testing.T) {
+	tests := []string{
+		"minConfirmations = -1",
+		"summaryMinConfirmations = -6",
+		"balanceMinConfirmations = -1",
+		"splitMode = unknown",
+	}
+	for _, conf := range tests {
+		c, err := config.NewConfigData("ini", []byte(conf))
+		if err != nil {
+			t.Errorf("NewConfigData failed unexpected error: %v", err)
+			continue
+		}
+		if err := NewWalletManager().LoadAssetsConfig(c); err == nil {
+			t.Errorf("config: %q should be rejected", conf)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	//模拟节点第一个区块的毫秒时间戳
+	mockGenesisTime = uint64(1560000000000)
+	//模拟节点的出块间隔，毫秒
+	mockBlockInterval = uint64(60000)
+	//模拟节点预估的每KB费率，最小单位
+	mockSmartFee = 1000
+)
+
+//MockHandler 模拟节点的方法处理函数，返回*RPCError时按节点错误格式返回
+type MockHandler func(params []gjson.Result) (interface{}, error)
+
+//MockInput 模拟交易单输入，字段与节点GetTransaction返回的一致
+type MockInput struct {
+	OutputTransactionHash string `json:"OutputTransactionHash"`
+	OutputIndex           uint64 `json:"OutputIndex"`
+	Amount                uint64 `json:"Amount"`
+	AccountID             string `json:"AccountId"`
+}
+
+//MockOutput 模拟交易单输出
+type MockOutput struct {
+	Index      uint64 `json:"Index"`
+	Amount     uint64 `json:"Amount"`
+	ReceiverID string `json:"ReceiverId"`
+	LockScript string `json:"LockScript"`
+	Spent      bool   `json:"Spent"`
+}
+
+//MockTransaction 模拟交易单
+type MockTransaction struct {
+	Hash        string        `json:"Hash"`
+	BlockHash   string        `json:"BlockHash"`
+	Version     uint64        `json:"Version"`
+	Timestamp   uint64        `json:"Timestamp"`
+	LockTime    int64         `json:"LockTime"`
+	ExpiredTime int64         `json:"ExpiredTime"`
+	Size        uint64        `json:"Size"`
+	Fee         uint64        `json:"Fee"`
+	Inputs      []*MockInput  `json:"Inputs"`
+	Outputs     []*MockOutput `json:"Outputs"`
+}
+
+//MockBlockHeader 模拟区块头
+type MockBlockHeader struct {
+	Height            uint64 `json:"Height"`
+	Hash              string `json:"Hash"`
+	PreviousBlockHash string `json:"PreviousBlockHash"`
+	Version           uint64 `json:"Version"`
+	Timestamp         uint64 `json:"Timestamp"`
+}
+
+//MockBlock 模拟区块
+type MockBlock struct {
+	Header       *MockBlockHeader   `json:"Header"`
+	Transactions []*MockTransaction `json:"Transactions"`
+}
+
+//NewMockTransaction 创建模拟交易单，交易单hash由输入输出确定
+func NewMockTransaction(inputs []*MockInput, outputs []*MockOutput) *MockTransaction {
+	for i, out := range outputs {
+		out.Index = uint64(i)
+	}
+	tx := &MockTransaction{
+		Version: uint64(TxVersion),
+		Inputs:  inputs,
+		Outputs: outputs,
+		Size:    uint64(EstimateTxSize(len(inputs), len(outputs))),
+	}
+	raw, _ := json.Marshal(tx)
+	tx.Hash = mockHash(raw)
+	return tx
+}
+
+//NewMockCoinbase 创建挖矿奖励交易单
+func NewMockCoinbase(address string, amount uint64, nonce int) *MockTransaction {
+	return NewMockTransaction(
+		[]*MockInput{{OutputTransactionHash: fmt.Sprintf("%064X", nonce), OutputIndex: 0}},
+		[]*MockOutput{{Amount: amount, ReceiverID: address}},
+	)
+}
+
+//MockNode 进程内的模拟FIII节点，提供确定的区块、交易单、utxo和交易池数据，用于离线测试
+type MockNode struct {
+	server     *httptest.Server
+	mu         sync.RWMutex
+	blocks     []*MockBlock
+	txs        map[string]*MockTransaction
+	mempool    []*MockTransaction
+	broadcasts []string
+	handlers   map[string]MockHandler
+}
+
+//NewMockNode 启动模拟节点，初始只有创世区块
+func NewMockNode() *MockNode {
+	node := &MockNode{
+		txs:      make(map[string]*MockTransaction),
+		handlers: make(map[string]MockHandler),
+	}
+	node.AddBlock()
+	node.server = httptest.NewServer(http.HandlerFunc(node.serveHTTP))
+	return node
+}
+
+//URL 模拟节点的地址
+func (node *MockNode) URL() string {
+	return node.server.URL
+}
+
+//Client 连接模拟节点的客户端
+func (node *MockNode) Client() *Client {
+	client := NewClient(node.URL(), false)
+	client.MaxRetries = 0
+	return client
+}
+
+//Close 关闭模拟节点
+func (node *MockNode) Close() {
+	node.server.Close()
+}
+
+//SetHandler 替换方法的处理函数，可用于模拟节点错误
+func (node *MockNode) SetHandler(method string, handler MockHandler) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.handlers[method] = handler
+}
+
+//AddBlock 打包交易单生成下一个区块，交易池中相同的交易单会被移除
+func (node *MockNode) AddBlock(txs ...*MockTransaction) *MockBlock {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	height := uint64(len(node.blocks))
+	header := &MockBlockHeader{
+		Height:    height,
+		Version:   1,
+		Timestamp: mockGenesisTime + height*mockBlockInterval,
+	}
+	if height > 0 {
+		header.PreviousBlockHash = node.blocks[height-1].Header.Hash
+	}
+
+	seed := fmt.Sprintf("%d:%s", height, header.PreviousBlockHash)
+	for _, tx := range txs {
+		seed += ":" + tx.Hash
+	}
+	header.Hash = mockHash([]byte(seed))
+
+	for _, tx := range txs {
+		tx.BlockHash = header.Hash
+		tx.Timestamp = header.Timestamp
+		node.txs[tx.Hash] = tx
+		node.removeMemPoolTx(tx.Hash)
+	}
+
+	block := &MockBlock{Header: header, Transactions: txs}
+	node.blocks = append(node.blocks, block)
+	return block
+}
+
+//RemoveBlocks 移除最新的n个区块，用于模拟分叉，区块中的交易单也被移除
+func (node *MockNode) RemoveBlocks(n int) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	for ; n > 0 && len(node.blocks) > 1; n-- {
+		block := node.blocks[len(node.blocks)-1]
+		for _, tx := range block.Transactions {
+			delete(node.txs, tx.Hash)
+		}
+		node.blocks = node.blocks[:len(node.blocks)-1]
+	}
+}
+
+//AddMemPoolTx 把交易单放入交易池
+func (node *MockNode) AddMemPoolTx(tx *MockTransaction) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.txs[tx.Hash] = tx
+	node.mempool = append(node.mempool, tx)
+}
+
+//Broadcasts 通过BroadcastTransaction提交的交易单
+func (node *MockNode) Broadcasts() []string {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	return append([]string{}, node.broadcasts...)
+}
+
+//Height 最新区块高度
+func (node *MockNode) Height() uint64 {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	return uint64(len(node.blocks) - 1)
+}
+
+//removeMemPoolTx 从交易池移除交易单，调用前需要加锁
+func (node *MockNode) removeMemPoolTx(hash string) {
+	for i, tx := range node.mempool {
+		if tx.Hash == hash {
+			node.mempool = append(node.mempool[:i], node.mempool[i+1:]...)
+			return
+		}
+	}
+}
+
+//serveHTTP 处理JSON-RPC请求，支持批量请求
+func (node *MockNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req := gjson.ParseBytes(body)
+	var resp interface{}
+	if req.IsArray() {
+		batch := make([]interface{}, 0)
+		for _, item := range req.Array() {
+			batch = append(batch, node.handle(item))
+		}
+		resp = batch
+	} else {
+		resp = node.handle(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+//handle 处理单个请求
+func (node *MockNode) handle(req gjson.Result) map[string]interface{} {
+	resp := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.Get("id").Value(),
+	}
+
+	method := req.Get("method").String()
+	params := req.Get("params").Array()
+
+	node.mu.RLock()
+	handler, ok := node.handlers[method]
+	node.mu.RUnlock()
+	if !ok {
+		handler = node.builtinHandler(method)
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	if handler == nil {
+		err = &RPCError{Code: RPCErrMethodNotFound, Message: "Method not found"}
+	} else {
+		result, err = handler(params)
+	}
+
+	if err != nil {
+		rpcErr, isRPCErr := err.(*RPCError)
+		if !isRPCErr {
+			rpcErr = &RPCError{Code: RPCErrMisc, Message: err.Error()}
+		}
+		resp["result"] = nil
+		resp["error"] = map[string]interface{}{"code": rpcErr.Code, "message": rpcErr.Message}
+		return resp
+	}
+
+	resp["result"] = result
+	return resp
+}
+
+//builtinHandler 模拟节点内置的方法
+func (node *MockNode) builtinHandler(method string) MockHandler {
+	switch method {
+	case "GetBlockChainInfo":
+		return node.getBlockChainInfo
+	case "GetBlockCount":
+		return func(params []gjson.Result) (interface{}, error) {
+			return node.Height(), nil
+		}
+	case "GetBlockHash":
+		return node.getBlockHash
+	case "GetBlock":
+		return node.getBlock
+	case "GetTransaction":
+		return node.getTransaction
+	case "GetAllTxInMemPool":
+		return node.getAllTxInMemPool
+	case "ListUnspent":
+		return node.listUnspent
+	case "EstimateSmartFee":
+		return func(params []gjson.Result) (interface{}, error) {
+			return mockSmartFee, nil
+		}
+	case "BroadcastTransaction":
+		return node.broadcastTransaction
+	}
+	return nil
+}
+
+func (node *MockNode) getBlockChainInfo(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	tip := node.blocks[len(node.blocks)-1].Header
+	return map[string]interface{}{
+		"isRunning":               true,
+		"connections":             8,
+		"localLastBlockHeight":    tip.Height,
+		"localLastBlockTime":      tip.Timestamp,
+		"remoteLatestBlockHeight": tip.Height,
+		"timeOffset":              0,
+	}, nil
+}
+
+func (node *MockNode) getBlockHash(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	if len(params) < 1 || params[0].Uint() >= uint64(len(node.blocks)) {
+		return nil, &RPCError{Code: RPCErrInvalidParameter, Message: "Block height out of range"}
+	}
+	return node.blocks[params[0].Uint()].Header.Hash, nil
+}
+
+func (node *MockNode) getBlock(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	if len(params) > 0 {
+		for _, block := range node.blocks {
+			if strings.EqualFold(block.Header.Hash, params[0].String()) {
+				return block, nil
+			}
+		}
+	}
+	return nil, &RPCError{Code: RPCErrInvalidAddressOrKey, Message: "Block not found"}
+}
+
+func (node *MockNode) getTransaction(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	if len(params) > 0 {
+		if tx, ok := node.txs[strings.ToUpper(params[0].String())]; ok {
+			//已打包的交易单返回确认数
+			result := struct {
+				*MockTransaction
+				Confirmations uint64 `json:"Confirmations"`
+			}{MockTransaction: tx}
+			for _, block := range node.blocks {
+				if block.Header.Hash == tx.BlockHash {
+					result.Confirmations = uint64(len(node.blocks)) - block.Header.Height
+				}
+			}
+			return result, nil
+		}
+	}
+	return nil, &RPCError{Code: RPCErrInvalidAddressOrKey, Message: "No information available about transaction"}
+}
+
+func (node *MockNode) getAllTxInMemPool(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+	txids := make([]string, 0, len(node.mempool))
+	for _, tx := range node.mempool {
+		txids = append(txids, tx.Hash)
+	}
+	return txids, nil
+}
+
+//listUnspent 由链上和交易池的交易单计算未花记录，参数: [minconf, maxconf, addresses]
+func (node *MockNode) listUnspent(params []gjson.Result) (interface{}, error) {
+	node.mu.RLock()
+	defer node.mu.RUnlock()
+
+	var (
+		minConf, maxConf uint64 = 0, 9999999
+		filter                  = make(map[string]bool)
+		spent                   = make(map[string]bool)
+		tip                     = uint64(len(node.blocks) - 1)
+		utxos                   = make([]map[string]interface{}, 0)
+	)
+	if len(params) > 0 {
+		minConf = params[0].Uint()
+	}
+	if len(params) > 1 {
+		maxConf = params[1].Uint()
+	}
+	if len(params) > 2 {
+		for _, a := range params[2].Array() {
+			filter[a.String()] = true
+		}
+	}
+
+	outpoint := func(txid string, vout uint64) string {
+		return fmt.Sprintf("%s:%d", txid, vout)
+	}
+
+	for _, block := range node.blocks {
+		for _, tx := range block.Transactions {
+			for _, in := range tx.Inputs {
+				spent[outpoint(in.OutputTransactionHash, in.OutputIndex)] = true
+			}
+		}
+	}
+	for _, tx := range node.mempool {
+		for _, in := range tx.Inputs {
+			spent[outpoint(in.OutputTransactionHash, in.OutputIndex)] = true
+		}
+	}
+
+	for _, block := range node.blocks {
+		confirmations := tip - block.Header.Height + 1
+		if confirmations < minConf || confirmations > maxConf {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				if spent[outpoint(tx.Hash, out.Index)] {
+					continue
+				}
+				if len(filter) > 0 && !filter[out.ReceiverID] {
+					continue
+				}
+				utxos = append(utxos, map[string]interface{}{
+					"txid":          tx.Hash,
+					"vout":          out.Index,
+					"address":       out.ReceiverID,
+					"account":       "",
+					"ScriptPubKey":  out.LockScript,
+					"amount":        out.Amount,
+					"confirmations": confirmations,
+					"solvable":      true,
+				})
+			}
+		}
+	}
+
+	return utxos, nil
+}
+
+//broadcastTransaction 记录提交的交易单，返回交易单hash
+func (node *MockNode) broadcastTransaction(params []gjson.Result) (interface{}, error) {
+	if len(params) < 1 {
+		return nil, &RPCError{Code: RPCErrInvalidParameter, Message: "Missing transaction"}
+	}
+	raw := params[0].Raw
+	node.mu.Lock()
+	node.broadcasts = append(node.broadcasts, raw)
+	node.mu.Unlock()
+	return mockHash([]byte(raw)), nil
+}
+
+//mockHash 确定的大写hex哈希
+func mockHash(data []byte) string {
+	hash := sha256.Sum256(data)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
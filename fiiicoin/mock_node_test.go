@@ -0,0 +1,234 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	mockAddressA = "fiiitCPyohiEPn9q11AXCdvVDouoVvgojXBcVj"
+	mockAddressB = "fiiitQ7VLGBrbc1HjgcAbbWEhDtNUCaYJHTnZB"
+)
+
+//testMockWalletManager 连接模拟节点的钱包管理器
+func testMockWalletManager(node *MockNode) *WalletManager {
+	wm := NewWalletManager()
+	wm.WalletClient = node.Client()
+	return wm
+}
+
+//testMockChain 区块1给A挖矿奖励，区块2由A转账给B，交易池中B转回A
+func testMockChain(node *MockNode) (*MockTransaction, *MockTransaction, *MockTransaction) {
+	coinbase := NewMockCoinbase(mockAddressA, 5000000000, 1)
+	node.AddBlock(coinbase)
+
+	pay := NewMockTransaction(
+		[]*MockInput{{OutputTransactionHash: coinbase.Hash, OutputIndex: 0, Amount: 5000000000, AccountID: mockAddressA}},
+		[]*MockOutput{{Amount: 1000000000, ReceiverID: mockAddressB}, {Amount: 3999000000, ReceiverID: mockAddressA}},
+	)
+	node.AddBlock(pay)
+
+	back := NewMockTransaction(
+		[]*MockInput{{OutputTransactionHash: pay.Hash, OutputIndex: 0, Amount: 1000000000, AccountID: mockAddressB}},
+		[]*MockOutput{{Amount: 999000000, ReceiverID: mockAddressA}},
+	)
+	node.AddMemPoolTx(back)
+
+	return coinbase, pay, back
+}
+
+func TestMockNode_Scanner(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+	_, pay, back := testMockChain(node)
+
+	wm := testMockWalletManager(node)
+
+	height, err := wm.GetBlockHeight()
+	if err != nil || height != 2 {
+		t.Errorf("GetBlockHeight unexpected height: %d, error: %v", height, err)
+		return
+	}
+
+	hash, err := wm.GetBlockHash(height)
+	if err != nil {
+		t.Errorf("GetBlockHash failed unexpected error: %v", err)
+		return
+	}
+
+	block, err := wm.GetBlock(hash)
+	if err != nil || block.Height != 2 || len(block.tx) != 1 || block.tx[0] != pay.Hash {
+		t.Errorf("GetBlock unexpected block: %+v, error: %v", block, err)
+		return
+	}
+
+	if _, err = wm.GetBlockHash(3); !IsRPCErrorCode(err, RPCErrInvalidParameter) {
+		t.Errorf("GetBlockHash out of range should return -8, got: %v", err)
+	}
+
+	txids, err := wm.GetTxIDsInMemPool()
+	if err != nil || len(txids) != 1 || txids[0] != back.Hash {
+		t.Errorf("GetTxIDsInMemPool unexpected txids: %v, error: %v", txids, err)
+	}
+
+	scanAddress := func(address string) (string, bool) {
+		return "accountB", address == mockAddressB
+	}
+	result := wm.Blockscanner.ExtractTransaction(block.Height, block.Hash, pay.Hash, scanAddress)
+	if !result.Success {
+		t.Errorf("ExtractTransaction failed")
+		return
+	}
+	data, ok := result.extractData["accountB"]
+	if !ok || len(data.TxOutputs) != 1 || data.TxOutputs[0].Amount != "10" {
+		t.Errorf("ExtractTransaction unexpected data: %+v", data)
+	}
+}
+
+func TestMockNode_Balance(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+	testMockChain(node)
+
+	wm := testMockWalletManager(node)
+
+	utxos, err := wm.ListUnspent(0, mockAddressA, mockAddressB)
+	if err != nil {
+		t.Errorf("ListUnspent failed unexpected error: %v", err)
+		return
+	}
+	//B的utxo已被交易池中的交易单花费
+	if len(utxos) != 1 || utxos[0].Address != mockAddressA || utxos[0].Amount != 3999000000 || utxos[0].Confirmations != 1 {
+		t.Errorf("ListUnspent unexpected utxos: %+v", utxos)
+	}
+
+	balances, err := wm.getBalanceCalUnspent(mockAddressA, mockAddressB)
+	if err != nil || len(balances) != 2 {
+		t.Errorf("getBalanceCalUnspent unexpected balances: %+v, error: %v", balances, err)
+		return
+	}
+	if balances[0].Balance != "39.99" || balances[1].Balance != "0" {
+		t.Errorf("unexpected balance of A: %s, B: %s", balances[0].Balance, balances[1].Balance)
+	}
+
+	feeRate, err := wm.estimateSmartFeeRate()
+	if err != nil || !feeRate.IsPositive() {
+		t.Errorf("estimateSmartFeeRate unexpected fee rate: %s, error: %v", feeRate.String(), err)
+	}
+}
+
+func TestMockNode_ScanEmbeddedTransactions(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+	_, pay, _ := testMockChain(node)
+	//扫描时节点已有更高的区块，确认数按节点高度计算
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 100))
+
+	//统计GetTransaction请求数
+	var requests int64
+	node.SetHandler("GetTransaction", func(params []gjson.Result) (interface{}, error) {
+		atomic.AddInt64(&requests, 1)
+		return node.getTransaction(params)
+	})
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, observer := testMockScanner(node, dir)
+	//不重扫已扫描的区块，每次只通知新区块的交易单
+	bs.RescanLastBlockCount = 0
+
+	block, err := bs.wm.GetBlock(node.blocks[2].Header.Hash)
+	if err != nil || !block.isVerbose || len(block.TxDetails()[pay.Hash].Vouts) != 2 {
+		t.Errorf("GetBlock unexpected tx details: %+v, error: %v", block, err)
+		return
+	}
+
+	//区块中已包含完整的交易单，不需要请求GetTransaction
+	bs.ScanBlockTask()
+	extracts := observer.waitExtracts(1)
+	if len(extracts) != 1 || extracts[0].Transaction.TxID != pay.Hash || extracts[0].TxOutputs[0].Amount != "10" || extracts[0].TxOutputs[0].Confirm != 2 {
+		t.Errorf("extract notifications: %+v", extracts)
+	}
+	if n := atomic.LoadInt64(&requests); n != 0 {
+		t.Errorf("GetTransaction requests: %d, want 0", n)
+	}
+
+	//区块中的交易单缺少输入时，向节点请求GetTransaction
+	node.SetHandler("GetBlock", func(params []gjson.Result) (interface{}, error) {
+		result, err := node.getBlock(params)
+		if err != nil {
+			return nil, err
+		}
+		block := *result.(*MockBlock)
+		txs := make([]*MockTransaction, 0, len(block.Transactions))
+		for _, tx := range block.Transactions {
+			stripped := *tx
+			stripped.Inputs = nil
+			txs = append(txs, &stripped)
+		}
+		block.Transactions = txs
+		return &block, nil
+	})
+
+	payB := NewMockCoinbase(mockAddressB, 1000000000, 3)
+	node.AddBlock(payB)
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 101))
+	bs.ScanBlockTask()
+	extracts = observer.waitExtracts(1)
+	if len(extracts) != 1 || extracts[0].Transaction.TxID != payB.Hash || extracts[0].TxOutputs[0].Amount != "10" || extracts[0].TxOutputs[0].Confirm != 2 {
+		t.Errorf("extract notifications: %+v", extracts)
+	}
+	if n := atomic.LoadInt64(&requests); n == 0 {
+		t.Errorf("GetTransaction should be requested when the block transactions are incomplete")
+	}
+
+	//批量获取失败后单独获取的交易单，确认数也按扫描时的节点高度计算，不使用节点返回的确认数
+	payC := NewMockCoinbase(mockAddressB, 1000000000, 4)
+	var payCRequests int64
+	node.SetHandler("GetTransaction", func(params []gjson.Result) (interface{}, error) {
+		if len(params) > 0 && strings.EqualFold(params[0].String(), payC.Hash) {
+			if atomic.AddInt64(&payCRequests, 1) == 1 {
+				return nil, &RPCError{Code: RPCErrDatabase, Message: "database error"}
+			}
+			return struct {
+				*MockTransaction
+				Confirmations uint64 `json:"Confirmations"`
+			}{MockTransaction: payC, Confirmations: 99}, nil
+		}
+		return node.getTransaction(params)
+	})
+	node.AddBlock(payC)
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 102))
+	bs.ScanBlockTask()
+	extracts = observer.waitExtracts(1)
+	if len(extracts) != 1 || extracts[0].Transaction.TxID != payC.Hash || extracts[0].TxOutputs[0].Confirm != 2 {
+		t.Errorf("extract notifications: %+v", extracts)
+	}
+	if n := atomic.LoadInt64(&payCRequests); n != 2 {
+		t.Errorf("GetTransaction requests of %s: %d, want 2", payC.Hash, n)
+	}
+}
@@ -18,6 +18,7 @@ package fiiicoin
 import (
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/tidwall/gjson"
+	"sort"
 )
 
 //BlockchainInfo 本地节点区块链信息
@@ -141,6 +142,7 @@ type Block struct {
 	Fork              bool
 	txDetails         []*Transaction
 	tx                []string
+	relevantTxs       map[string][]string //与钱包相关的交易单: sourceKey
 	isVerbose         bool
 }
 
@@ -154,17 +156,83 @@ func NewBlock(json *gjson.Result) *Block {
 	obj.Time = gjson.Get(json.Raw, "Header.Timestamp").Uint()
 
 	txs := make([]string, 0)
-	//txDetails := make([]*Transaction, 0)
+	txDetails := make([]*Transaction, 0)
 	for _, tx := range gjson.Get(json.Raw, "Transactions").Array() {
 		txs = append(txs, tx.Get("Hash").String())
+		//区块中包含完整输入输出的交易单，提取时不需要再请求GetTransaction
+		if isTxDetailComplete(&tx) {
+			trx := newTxByCore(&tx)
+			trx.BlockHeight = obj.Height
+			trx.BlockHash = obj.Hash
+			trx.Blocktime = int64(obj.Time)
+			txDetails = append(txDetails, trx)
+		}
 	}
 
 	obj.tx = txs
-	//obj.txDetails = txDetails
+	obj.txDetails = txDetails
+	obj.isVerbose = len(txs) > 0 && len(txDetails) == len(txs)
 
 	return obj
 }
 
+//TxDetails 区块中包含完整数据的交易单，key为交易单ID
+func (b *Block) TxDetails() map[string]*Transaction {
+	details := make(map[string]*Transaction, len(b.txDetails))
+	for _, trx := range b.txDetails {
+		details[trx.TxID] = trx
+	}
+	return details
+}
+
+//isTxDetailComplete 交易单是否包含提取需要的字段：输入的地址和数量，输出的接收地址和数量。
+//挖矿奖励的输入没有地址，但字段必须存在。
+func isTxDetailComplete(json *gjson.Result) bool {
+
+	if len(json.Get("Hash").String()) == 0 {
+		return false
+	}
+
+	inputs, outputs := json.Get("Inputs"), json.Get("Outputs")
+	if !inputs.IsArray() || !outputs.IsArray() {
+		return false
+	}
+
+	for _, input := range inputs.Array() {
+		if !input.Get("AccountId").Exists() || !input.Get("Amount").Exists() {
+			return false
+		}
+	}
+
+	for _, output := range outputs.Array() {
+		if !output.Get("ReceiverId").Exists() || !output.Get("Amount").Exists() {
+			return false
+		}
+	}
+
+	return true
+}
+
+//TxIDs 区块中的所有交易单ID
+func (b *Block) TxIDs() []string {
+	return b.tx
+}
+
+//RelevantTxIDs 扫描时提取到与钱包相关的交易单ID，按ID排序
+func (b *Block) RelevantTxIDs() []string {
+	txids := make([]string, 0, len(b.relevantTxs))
+	for txid := range b.relevantTxs {
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+	return txids
+}
+
+//RelevantSourceKeys 交易单相关的钱包sourceKey
+func (b *Block) RelevantSourceKeys(txid string) []string {
+	return b.relevantTxs[txid]
+}
+
 //BlockHeader 区块链头
 func (b *Block) BlockHeader(symbol string) *openwallet.BlockHeader {
 
@@ -247,8 +315,10 @@ func newTxByCore(json *gjson.Result) *Transaction {
 	obj.Timestamp = gjson.Get(json.Raw, "Timestamp").Int()
 	obj.ExpiredTime = gjson.Get(json.Raw, "ExpiredTime").Int()
 	obj.BlockHash = gjson.Get(json.Raw, "BlockHash").String()
+	obj.Confirmations = gjson.Get(json.Raw, "Confirmations").Uint()
 	obj.Size = gjson.Get(json.Raw, "Size").Uint()
 	obj.Fees = gjson.Get(json.Raw, "Fee").Uint()
+	obj.IsDiscarded = gjson.Get(json.Raw, "IsDiscarded").Bool()
 	obj.Decimals = Decimals
 	obj.Vins = make([]*Vin, 0)
 	if vins := gjson.Get(json.Raw, "Inputs"); vins.IsArray() {
@@ -321,6 +391,8 @@ func newTxVoutByCore(json *gjson.Result) *Vout {
 	obj.Vout = gjson.Get(json.Raw, "Index").Uint()
 	obj.LockScript = gjson.Get(json.Raw, "LockScript").String()
 	obj.Addr = gjson.Get(json.Raw, "ReceiverId").String()
+	obj.Spent = gjson.Get(json.Raw, "Spent").Bool()
+	obj.IsDiscarded = gjson.Get(json.Raw, "IsDiscarded").Bool()
 
 	return &obj
 }
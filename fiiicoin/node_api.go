@@ -16,68 +16,407 @@
 package fiiicoin
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/blocktree/openwallet/log"
 	"github.com/imroc/req"
 	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//默认每次请求的超时时间
+	defaultRPCTimeout = 30 * time.Second
+	//默认最大重试次数
+	defaultRPCMaxRetries = 3
+	//默认第一次重试前的等待时间
+	defaultRPCRetryBackoff = 500 * time.Millisecond
+	//重试等待时间的上限
+	maxRPCRetryBackoff = 10 * time.Second
+	//默认每次批量请求的最大请求数
+	defaultRPCBatchSize = 100
 )
 
 type ClientInterface interface {
 	Call(path string, request []interface{}) (*gjson.Result, error)
+	CallContext(ctx context.Context, path string, request []interface{}) (*gjson.Result, error)
+	BatchCall(requests []*BatchRequest) ([]*BatchResult, error)
+	BatchCallContext(ctx context.Context, requests []*BatchRequest) ([]*BatchResult, error)
+}
+
+//ClientAuth 节点连接的认证和TLS配置，用于节点部署在需要认证的反向代理之后
+type ClientAuth struct {
+	Username           string //basic auth用户名
+	Password           string //basic auth密码
+	BearerToken        string //bearer token，不能与basic auth同时使用
+	CAFile             string //验证服务端证书的CA证书文件，PEM格式
+	CertFile           string //客户端证书文件，PEM格式
+	KeyFile            string //客户端证书私钥文件，PEM格式
+	InsecureSkipVerify bool   //不验证服务端证书，只用于测试
+}
+
+//BatchRequest 批量请求中的一个请求
+type BatchRequest struct {
+	Method string
+	Params []interface{}
+}
+
+//BatchResult 批量请求中一个请求的结果，按请求的顺序返回
+type BatchResult struct {
+	Result *gjson.Result
+	Error  error
 }
 
 // A Client is a Bitcoin RPC client. It performs RPCs over HTTP using JSON
 // request and responses. A Client must be configured with a secret token
 // to authenticate with other Cores on the network.
 type Client struct {
-	BaseURL string
-	Debug   bool
-	client  *req.Req
+	BaseURL      string
+	Debug        bool
+	Timeout      time.Duration //每次请求的超时时间，0不限制
+	MaxRetries   int           //传输错误和5xx错误的最大重试次数
+	RetryBackoff time.Duration //第一次重试前的等待时间，之后每次加倍
+	MaxBatchSize int           //每次批量请求的最大请求数，0不限制
+	limiter      *RateLimiter  //限流器，nil不限制
+	client       *req.Req
+	requestID    uint64
+	authHeader   string
 }
 
 func NewClient(url string, debug bool) *Client {
 	c := Client{
-		BaseURL: url,
-		Debug:   debug,
+		BaseURL:      url,
+		Debug:        debug,
+		Timeout:      defaultRPCTimeout,
+		MaxRetries:   defaultRPCMaxRetries,
+		RetryBackoff: defaultRPCRetryBackoff,
+		MaxBatchSize: defaultRPCBatchSize,
 	}
 
 	api := req.New()
-	//trans, _ := api.Client().Transport.(*http.Transport)
-	//trans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	//提前创建http客户端，req在首次请求时才创建，并发请求会有数据竞争
+	api.Client()
 	c.client = api
 
 	return &c
 }
 
+//SetAuth 设置请求的认证信息和TLS配置
+func (c *Client) SetAuth(auth *ClientAuth) error {
+
+	if auth == nil {
+		return nil
+	}
+
+	if len(auth.BearerToken) > 0 && len(auth.Username) > 0 {
+		return errors.New("bearer token and basic auth can not be used together")
+	}
+
+	if (len(auth.CertFile) > 0) != (len(auth.KeyFile) > 0) {
+		return errors.New("client certificate and key should be set together")
+	}
+
+	if len(auth.BearerToken) > 0 {
+		c.authHeader = "Bearer " + auth.BearerToken
+	} else if len(auth.Username) > 0 {
+		c.authHeader = "Basic " + BasicAuth(auth.Username, auth.Password)
+	} else {
+		c.authHeader = ""
+	}
+
+	if len(c.authHeader) > 0 && strings.HasPrefix(strings.ToLower(c.BaseURL), "http://") {
+		log.Std.Warning("node: %s credentials are sent without TLS", c.BaseURL)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: auth.InsecureSkipVerify,
+	}
+
+	if len(auth.CAFile) > 0 {
+		caCert, err := ioutil.ReadFile(auth.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA file failed, unexpected error: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("CA file: %s has no valid certificate", auth.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(auth.CertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate failed, unexpected error: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := c.Transport()
+	if recording, isRecording := transport.(*recordingTransport); isRecording {
+		transport = recording.next
+	}
+	trans, ok := transport.(*http.Transport)
+	if !ok {
+		return errors.New("client transport does not support TLS config")
+	}
+	trans.TLSClientConfig = tlsConfig
+
+	return nil
+}
+
+//Transport 底层http请求的RoundTripper
+func (c *Client) Transport() http.RoundTripper {
+	return c.client.Client().Transport
+}
+
+//SetTransport 替换底层http请求的RoundTripper，如回放记录的ReplayTransport
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.client.Client().Transport = transport
+}
+
+//SetRecorder 记录之后的所有请求和响应
+func (c *Client) SetRecorder(recorder *RPCRecorder) {
+	c.SetTransport(recorder.Wrap(c.Transport()))
+}
+
 // Call calls a remote procedure on another node, specified by the path.
 func (c *Client) Call(path string, request []interface{}) (*gjson.Result, error) {
+	return c.CallContext(context.Background(), path, request)
+}
 
-	var (
-		body = make(map[string]interface{}, 0)
-	)
+// CallContext calls a remote procedure with the context, transport errors and
+// 5xx responses are retried with exponential backoff until ctx is done.
+func (c *Client) CallContext(ctx context.Context, path string, request []interface{}) (*gjson.Result, error) {
 
 	if c.client == nil {
 		return nil, errors.New("API url is not setup. ")
 	}
 
-	authHeader := req.Header{
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
+	//每次请求使用唯一的id，并与响应的id比较
+	id := c.nextRequestID()
+	body := newRequestBody(id, path, request)
+
+	resp, err := c.postWithRetry(ctx, path, body, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseResponse(path, resp, id)
+}
+
+// BatchCall sends the requests as json-rpc batches, the results are in the
+// same order as the requests.
+func (c *Client) BatchCall(requests []*BatchRequest) ([]*BatchResult, error) {
+	return c.BatchCallContext(context.Background(), requests)
+}
+
+// BatchCallContext sends the requests as json-rpc batches of MaxBatchSize with
+// the context, the responses are correlated to the requests by id.
+func (c *Client) BatchCallContext(ctx context.Context, requests []*BatchRequest) ([]*BatchResult, error) {
+
+	if c.client == nil {
+		return nil, errors.New("API url is not setup. ")
+	}
+
+	results := make([]*BatchResult, len(requests))
+
+	size := c.MaxBatchSize
+	if size <= 0 {
+		size = len(requests)
+	}
+
+	for begin := 0; begin < len(requests); begin += size {
+		end := begin + size
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		err := c.batchCall(ctx, requests[begin:end], results[begin:end])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+//batchCall 发送一次批量请求，结果写入results
+func (c *Client) batchCall(ctx context.Context, requests []*BatchRequest, results []*BatchResult) error {
+
+	var (
+		ids    = make([]string, len(requests))
+		bodies = make([]map[string]interface{}, len(requests))
+		items  = make(map[string]gjson.Result)
+	)
+
+	for i, request := range requests {
+		ids[i] = c.nextRequestID()
+		bodies[i] = newRequestBody(ids[i], request.Method, request.Params)
+	}
+
+	resp, err := c.postWithRetry(ctx, "batch", bodies, len(bodies))
+	if err != nil {
+		return err
+	}
+
+	if !resp.IsArray() {
+		//节点不支持批量请求时返回单个错误
+		err = isError("batch", resp)
+		if err != nil {
+			return err
+		}
+		return errors.New("batch response is not an array")
+	}
+
+	for _, item := range resp.Array() {
+		items[item.Get("id").String()] = item
+	}
+
+	for i, id := range ids {
+		item, ok := items[id]
+		if !ok {
+			results[i] = &BatchResult{Error: fmt.Errorf("response of request id: %s is not found", id)}
+			continue
+		}
+		result, err := parseResponse(requests[i].Method, &item, id)
+		results[i] = &BatchResult{Result: result, Error: err}
 	}
 
-	//json-rpc
+	return nil
+}
+
+//nextRequestID 唯一的请求id
+func (c *Client) nextRequestID() string {
+	return strconv.FormatUint(atomic.AddUint64(&c.requestID, 1), 10)
+}
+
+//newRequestBody json-rpc请求内容
+func newRequestBody(id, path string, request []interface{}) map[string]interface{} {
+	body := make(map[string]interface{}, 0)
 	body["jsonrpc"] = "2.0"
-	body["id"] = "1"
+	body["id"] = id
 	body["method"] = path
 	body["params"] = request
+	return body
+}
+
+//parseResponse 检查响应的id和错误，返回result
+func parseResponse(method string, resp *gjson.Result, id string) (*gjson.Result, error) {
+
+	if respID := resp.Get("id"); respID.Exists() && respID.Type != gjson.Null && respID.String() != id {
+		return nil, fmt.Errorf("response id: %s is not equal to request id: %s", respID.String(), id)
+	}
+
+	err := isError(method, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	result := resp.Get("result")
+
+	return &result, nil
+}
+
+//postWithRetry 发送请求，传输错误和5xx错误按指数退避重试，calls为请求包含的调用数
+func (c *Client) postWithRetry(ctx context.Context, path string, body interface{}, calls int) (*gjson.Result, error) {
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+
+		resp, retryable, err := c.limitedPost(ctx, body, calls)
+		if err == nil {
+			return resp, nil
+		}
+
+		if !retryable || ctx.Err() != nil {
+			return nil, err
+		}
+
+		if attempt >= c.MaxRetries {
+			return nil, &nodeUnavailableError{err: err}
+		}
+
+		log.Std.Warning("Request API: %s failed: %v, retry %d after %v", path, err, attempt+1, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = backoff * 2
+		if backoff > maxRPCRetryBackoff {
+			backoff = maxRPCRetryBackoff
+		}
+	}
+}
+
+//limitedPost 经过限流器发送一次请求
+func (c *Client) limitedPost(ctx context.Context, body interface{}, calls int) (*gjson.Result, bool, error) {
+
+	if c.limiter == nil {
+		return c.post(ctx, body)
+	}
+
+	release, err := c.limiter.Acquire(ctx, calls)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	return c.post(ctx, body)
+}
+
+//SetRateLimit 设置每秒请求数、令牌桶容量、最大并发数和最大等待数，rate和maxInFlight都为0时不限制
+func (c *Client) SetRateLimit(rate float64, burst, maxInFlight, maxQueued int) {
+	if rate <= 0 && maxInFlight <= 0 {
+		c.limiter = nil
+		return
+	}
+	c.limiter = NewRateLimiter(rate, burst, maxInFlight, maxQueued)
+}
+
+//LimiterStats 限流器的统计数据，没有限流时返回nil
+func (c *Client) LimiterStats() *LimiterStats {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.Stats()
+}
+
+//post 发送一次请求，返回的错误是否可以重试
+func (c *Client) post(ctx context.Context, body interface{}) (*gjson.Result, bool, error) {
+
+	authHeader := req.Header{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+	}
+
+	if len(c.authHeader) > 0 {
+		authHeader["Authorization"] = c.authHeader
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
 	if c.Debug {
 		log.Std.Info("Start Request API...")
 	}
 
-	r, err := c.client.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
+	r, err := c.client.Post(c.BaseURL, req.BodyJSON(body), authHeader, ctx)
 
 	if c.Debug {
 		log.Std.Info("Request API Completed")
@@ -87,19 +426,39 @@ func (c *Client) Call(path string, request []interface{}) (*gjson.Result, error)
 		log.Std.Info("%+v", r)
 	}
 
+	//传输错误
 	if err != nil {
-		return nil, err
+		return nil, true, err
 	}
 
-	resp := gjson.ParseBytes(r.Bytes())
-	err = isError(&resp)
+	respBytes, err := r.ToBytes()
 	if err != nil {
-		return nil, err
+		return nil, true, err
 	}
 
-	result := resp.Get("result")
+	resp := gjson.ParseBytes(respBytes)
 
-	return &result, nil
+	//没有json-rpc错误信息的5xx响应视为节点临时故障
+	if statusCode := r.Response().StatusCode; statusCode >= http.StatusInternalServerError && !resp.Get("error").IsObject() && !resp.IsArray() {
+		return nil, true, fmt.Errorf("server response status: %d", statusCode)
+	}
+
+	return &resp, false, nil
+}
+
+//nodeUnavailableError 重试后节点仍不可用，节点池可以切换到其他节点
+type nodeUnavailableError struct {
+	err error
+}
+
+func (e *nodeUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+//isNodeUnavailable 是否节点不可用的错误
+func isNodeUnavailable(err error) bool {
+	_, ok := err.(*nodeUnavailableError)
+	return ok
 }
 
 // See 2 (end of page 4) http://www.ietf.org/rfc/rfc2617.txt
@@ -113,10 +472,7 @@ func BasicAuth(username, password string) string {
 }
 
 //isError 是否报错
-func isError(result *gjson.Result) error {
-	var (
-		err error
-	)
+func isError(method string, result *gjson.Result) error {
 
 	/*
 		//failed 返回错误
@@ -139,10 +495,9 @@ func isError(result *gjson.Result) error {
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error.message").String())
-	err = errors.New(errInfo)
-
-	return err
+	return &RPCError{
+		Method:  method,
+		Code:    result.Get("error.code").Int(),
+		Message: result.Get("error.message").String(),
+	}
 }
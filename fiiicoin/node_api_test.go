@@ -0,0 +1,261 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"encoding/pem"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//testRPCServer 模拟节点，前failures次请求返回503
+func testRPCServer(failures int32, result string) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		id := gjson.GetBytes(body, "id").String()
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"` + id + `",` + result + `}`))
+	}))
+	return server, &hits
+}
+
+func TestClient_CallRetry(t *testing.T) {
+	server, hits := testRPCServer(2, `"result":100`)
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.RetryBackoff = time.Millisecond
+
+	result, err := client.Call("GetBlockCount", nil)
+	if err != nil {
+		t.Errorf("Call failed unexpected error: %v", err)
+		return
+	}
+	if result.Int() != 100 || atomic.LoadInt32(hits) != 3 {
+		t.Errorf("result: %s, requests: %d", result.String(), atomic.LoadInt32(hits))
+	}
+
+	//超过最大重试次数
+	server2, hits2 := testRPCServer(10, `"result":100`)
+	defer server2.Close()
+
+	client = NewClient(server2.URL, false)
+	client.RetryBackoff = time.Millisecond
+	client.MaxRetries = 1
+	if _, err = client.Call("GetBlockCount", nil); err == nil {
+		t.Errorf("Call should be failed after retries")
+	}
+	if atomic.LoadInt32(hits2) != 2 {
+		t.Errorf("requests: %d", atomic.LoadInt32(hits2))
+	}
+}
+
+func TestClient_CallApplicationError(t *testing.T) {
+	server, hits := testRPCServer(0, `"result":null,"error":{"code":-8,"message":"Block height out of range"}`)
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.RetryBackoff = time.Millisecond
+
+	_, err := client.Call("GetBlockHash", []interface{}{-1})
+	if err == nil || err.Error() != "[-8]Block height out of range" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(hits) != 1 {
+		t.Errorf("application error should not be retried, requests: %d", atomic.LoadInt32(hits))
+	}
+
+	rpcErr, ok := AsRPCError(err)
+	if !ok || rpcErr.Method != "GetBlockHash" || !IsRPCErrorCode(err, RPCErrInvalidParameter) {
+		t.Errorf("unexpected rpc error: %+v", rpcErr)
+	}
+	if IsNodeUnavailable(err) {
+		t.Errorf("application error should not be node unavailable")
+	}
+
+	tests := []struct {
+		err  error
+		code uint64
+	}{
+		{&RPCError{Method: "BroadcastTransaction", Code: RPCErrVerifyRejected}, openwallet.ErrSubmitRawTransactionFailed},
+		{&RPCError{Method: "GetBlock", Code: RPCErrClientInInitialSync}, openwallet.ErrCallFullNodeAPIFailed},
+		{&RPCError{Method: "GetBlockHash", Code: RPCErrInvalidParameter}, openwallet.ErrUnknownException},
+		{&nodeUnavailableError{err: context.DeadlineExceeded}, openwallet.ErrCallFullNodeAPIFailed},
+		{&NodeNotReadyError{Reason: NodeNoConnections, detail: "node has no connections"}, openwallet.ErrCallFullNodeAPIFailed},
+	}
+	for i, test := range tests {
+		if code := ConvertRPCError(test.err, openwallet.ErrUnknownException).Code(); code != test.code {
+			t.Errorf("case[%d] code: %d, expected: %d", i, code, test.code)
+		}
+	}
+}
+
+func TestClient_CallContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"0","result":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.Timeout = 50 * time.Millisecond
+	client.MaxRetries = 0
+
+	if _, err := client.Call("GetBlockCount", nil); err == nil {
+		t.Errorf("Call should be timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.Timeout = 0
+	if _, err := client.CallContext(ctx, "GetBlockCount", nil); err == nil {
+		t.Errorf("CallContext should be canceled")
+	}
+
+	//响应的id不一致
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"0","result":1}`))
+	}))
+	defer server2.Close()
+
+	client = NewClient(server2.URL, false)
+	if _, err := client.Call("GetBlockCount", nil); err == nil {
+		t.Errorf("Call should be failed when response id is mismatched")
+	}
+}
+
+func TestClient_BatchCall(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		//倒序返回，客户端按id匹配
+		items := gjson.ParseBytes(body).Array()
+		resp := make([]string, 0, len(items))
+		for i := len(items) - 1; i >= 0; i-- {
+			id := items[i].Get("id").String()
+			txid := items[i].Get("params.0").String()
+			if txid == "bad" {
+				resp = append(resp, `{"jsonrpc":"2.0","id":"`+id+`","result":null,"error":{"code":-5,"message":"No information available about transaction"}}`)
+				continue
+			}
+			resp = append(resp, `{"jsonrpc":"2.0","id":"`+id+`","result":"`+txid+`"}`)
+		}
+		w.Write([]byte("[" + strings.Join(resp, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.MaxBatchSize = 2
+
+	requests := make([]*BatchRequest, 0)
+	for _, txid := range []string{"a", "b", "bad", "c", "d"} {
+		requests = append(requests, &BatchRequest{Method: "GetTransaction", Params: []interface{}{txid}})
+	}
+
+	results, err := client.BatchCall(requests)
+	if err != nil {
+		t.Errorf("BatchCall failed unexpected error: %v", err)
+		return
+	}
+
+	for i, r := range results {
+		txid := requests[i].Params[0].(string)
+		if txid == "bad" {
+			if r.Error == nil {
+				t.Errorf("result[%d] should be failed", i)
+			}
+			continue
+		}
+		if r.Error != nil || r.Result.String() != txid {
+			t.Errorf("result[%d]: %v, unexpected error: %v", i, r.Result, r.Error)
+		}
+	}
+
+	if atomic.LoadInt32(&hits) != 3 {
+		t.Errorf("requests: %d", atomic.LoadInt32(&hits))
+	}
+}
+
+func TestClient_SetAuth(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+BasicAuth("fiii", "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"jsonrpc":"2.0","result":null,"error":{"code":401,"message":"unauthorized"}}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","result":1}`))
+	}))
+	defer server.Close()
+
+	//未配置CA证书，验证服务端证书失败
+	client := NewClient(server.URL, false)
+	client.MaxRetries = 0
+	if _, err := client.Call("GetBlockCount", nil); err == nil {
+		t.Errorf("Call should be failed without CA")
+	}
+
+	dir, err := ioutil.TempDir("", "fiii")
+	if err != nil {
+		t.Errorf("create temp dir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Errorf("write CA file failed unexpected error: %v", err)
+		return
+	}
+
+	err = client.SetAuth(&ClientAuth{CAFile: caFile})
+	if err != nil {
+		t.Errorf("SetAuth failed unexpected error: %v", err)
+		return
+	}
+	if _, err = client.Call("GetBlockCount", nil); err == nil || err.Error() != "[401]unauthorized" {
+		t.Errorf("Call should be unauthorized, unexpected error: %v", err)
+	}
+
+	err = client.SetAuth(&ClientAuth{Username: "fiii", Password: "secret", CAFile: caFile})
+	if err != nil {
+		t.Errorf("SetAuth failed unexpected error: %v", err)
+		return
+	}
+	if _, err = client.Call("GetBlockCount", nil); err != nil {
+		t.Errorf("Call failed unexpected error: %v", err)
+	}
+
+	if err = client.SetAuth(&ClientAuth{Username: "fiii", BearerToken: "token"}); err == nil {
+		t.Errorf("bearer token and basic auth should not be used together")
+	}
+}
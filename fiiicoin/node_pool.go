@@ -0,0 +1,404 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"fmt"
+	"github.com/blocktree/openwallet/log"
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//默认节点落后网络的最大区块数
+	defaultNodeMaxBlockLag = 3
+	//默认节点健康检查的间隔
+	defaultNodeHealthCheckInterval = 60 * time.Second
+)
+
+//poolNode 节点池中的节点
+type poolNode struct {
+	client    *Client
+	healthy   bool
+	info      *BlockchainInfo
+	lastError error
+}
+
+//ClientPool 多个FIII节点的客户端池，请求优先发送到当前健康的节点，节点不可用时自动切换。
+//Quorum大于1时，GetBlockCount和GetBlockHash需要多个节点的结果一致才被信任。
+type ClientPool struct {
+	Quorum              int           //需要结果一致的节点数量，0和1不检查
+	MaxBlockLag         uint64        //节点本地区块高度落后网络的最大区块数
+	MaxTimeOffset       time.Duration //节点时间与网络的最大差值，0不检查
+	HealthCheckInterval time.Duration //健康检查的间隔，0不自动检查
+
+	mu        sync.Mutex
+	nodes     []*poolNode
+	current   int
+	checkedAt time.Time
+}
+
+//NewClientPool 创建节点池，urls按优先级排序
+func NewClientPool(urls []string, debug bool) *ClientPool {
+	pool := &ClientPool{
+		MaxBlockLag:         defaultNodeMaxBlockLag,
+		MaxTimeOffset:       defaultNodeMaxTimeOffset,
+		HealthCheckInterval: defaultNodeHealthCheckInterval,
+	}
+	for _, url := range urls {
+		pool.nodes = append(pool.nodes, &poolNode{
+			client:  NewClient(url, debug),
+			healthy: true,
+		})
+	}
+	return pool
+}
+
+//ParseServerAPIs 解析逗号分隔的节点地址
+func ParseServerAPIs(serverAPI string) []string {
+	urls := make([]string, 0)
+	for _, url := range strings.Split(serverAPI, ",") {
+		url = strings.TrimSpace(url)
+		if len(url) > 0 {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+//Clients 节点池中的所有客户端
+func (p *ClientPool) Clients() []*Client {
+	clients := make([]*Client, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		clients = append(clients, node.client)
+	}
+	return clients
+}
+
+//SetDebug 设置所有客户端的调试模式
+func (p *ClientPool) SetDebug(debug bool) {
+	for _, node := range p.nodes {
+		node.client.Debug = debug
+	}
+}
+
+//LimiterStats 各节点限流器的统计数据，key为节点地址，没有限流的节点不返回
+func (p *ClientPool) LimiterStats() map[string]*LimiterStats {
+	stats := make(map[string]*LimiterStats)
+	for _, node := range p.nodes {
+		if s := node.client.LimiterStats(); s != nil {
+			stats[node.client.BaseURL] = s
+		}
+	}
+	return stats
+}
+
+//Current 当前使用的节点客户端
+func (p *ClientPool) Current() *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.nodes) == 0 {
+		return nil
+	}
+	return p.nodes[p.current].client
+}
+
+//Call 向当前节点发送请求，节点不可用时切换到下一个节点
+func (p *ClientPool) Call(path string, request []interface{}) (*gjson.Result, error) {
+	return p.CallContext(context.Background(), path, request)
+}
+
+//CallContext 向当前节点发送请求，节点不可用时切换到下一个节点
+func (p *ClientPool) CallContext(ctx context.Context, path string, request []interface{}) (*gjson.Result, error) {
+	var result *gjson.Result
+	err := p.withFailover(ctx, func(client *Client) error {
+		var err error
+		result, err = client.CallContext(ctx, path, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//BatchCall 向当前节点发送批量请求，节点不可用时切换到下一个节点
+func (p *ClientPool) BatchCall(requests []*BatchRequest) ([]*BatchResult, error) {
+	return p.BatchCallContext(context.Background(), requests)
+}
+
+//BatchCallContext 向当前节点发送批量请求，节点不可用时切换到下一个节点
+func (p *ClientPool) BatchCallContext(ctx context.Context, requests []*BatchRequest) ([]*BatchResult, error) {
+	var results []*BatchResult
+	err := p.withFailover(ctx, func(client *Client) error {
+		var err error
+		results, err = client.BatchCallContext(ctx, requests)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+//withFailover 按顺序使用节点执行请求，只有节点不可用才切换，节点返回的错误直接返回
+func (p *ClientPool) withFailover(ctx context.Context, call func(client *Client) error) error {
+
+	if len(p.nodes) == 0 {
+		return fmt.Errorf("API url is not setup. ")
+	}
+
+	p.checkHealthIfExpired(ctx)
+
+	var lastErr error
+	for _, i := range p.candidates() {
+		err := call(p.nodes[i].client)
+		if err == nil {
+			p.setCurrent(i)
+			return nil
+		}
+
+		if !isNodeUnavailable(err) {
+			return err
+		}
+
+		p.setUnhealthy(i, err)
+		lastErr = err
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+//QuorumCall 向所有健康节点请求，至少Quorum个节点返回相同的结果才返回
+func (p *ClientPool) QuorumCall(ctx context.Context, path string, request []interface{}) (*gjson.Result, error) {
+
+	if p.Quorum <= 1 {
+		return p.CallContext(ctx, path, request)
+	}
+
+	results, err := p.callHealthyNodes(ctx, path, request)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Raw]++
+		if counts[result.Raw] >= p.Quorum {
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s results of %d nodes do not reach quorum: %d", path, len(results), p.Quorum)
+}
+
+//QuorumBlockCount 至少Quorum个节点都已达到的最高区块高度
+func (p *ClientPool) QuorumBlockCount(ctx context.Context) (uint64, error) {
+
+	if p.Quorum <= 1 {
+		result, err := p.CallContext(ctx, "GetBlockCount", nil)
+		if err != nil {
+			return 0, err
+		}
+		return result.Uint(), nil
+	}
+
+	results, err := p.callHealthyNodes(ctx, "GetBlockCount", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(results) < p.Quorum {
+		return 0, fmt.Errorf("GetBlockCount results of %d nodes do not reach quorum: %d", len(results), p.Quorum)
+	}
+
+	heights := make([]uint64, 0, len(results))
+	for _, result := range results {
+		heights = append(heights, result.Uint())
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] > heights[j]
+	})
+
+	return heights[p.Quorum-1], nil
+}
+
+//CheckHealth 使用GetBlockChainInfo检查所有节点，节点需要正在运行、有连接，落后网络不超过MaxBlockLag，并且时间差不超过MaxTimeOffset
+func (p *ClientPool) CheckHealth(ctx context.Context) {
+
+	var wg sync.WaitGroup
+
+	for i := range p.nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var info *BlockchainInfo
+			result, err := p.nodes[i].client.CallContext(ctx, "GetBlockChainInfo", nil)
+			if err == nil {
+				info = NewBlockchainInfo(result)
+				err = p.checkBlockchainInfo(info)
+			}
+
+			p.mu.Lock()
+			p.nodes[i].info = info
+			p.nodes[i].healthy = err == nil
+			p.nodes[i].lastError = err
+			p.mu.Unlock()
+
+			if err != nil {
+				log.Std.Warning("node: %s is unhealthy, %v", p.nodes[i].client.BaseURL, err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	p.mu.Lock()
+	p.checkedAt = time.Now()
+	//当前节点不健康时切换到第一个健康的节点
+	if !p.nodes[p.current].healthy {
+		for i, node := range p.nodes {
+			if node.healthy {
+				p.current = i
+				break
+			}
+		}
+	}
+	p.mu.Unlock()
+}
+
+//checkBlockchainInfo 检查节点的区块链信息
+func (p *ClientPool) checkBlockchainInfo(info *BlockchainInfo) error {
+	return checkNodeReadiness(info, p.MaxBlockLag, p.MaxTimeOffset)
+}
+
+//checkHealthIfExpired 超过检查间隔时检查节点健康，只有一个节点时不检查
+func (p *ClientPool) checkHealthIfExpired(ctx context.Context) {
+	if len(p.nodes) <= 1 || p.HealthCheckInterval <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	expired := time.Since(p.checkedAt) >= p.HealthCheckInterval
+	if expired {
+		//避免并发的请求重复检查
+		p.checkedAt = time.Now()
+	}
+	p.mu.Unlock()
+
+	if expired {
+		p.CheckHealth(ctx)
+	}
+}
+
+//candidates 请求节点的顺序：当前节点，其他健康节点，最后是不健康的节点
+func (p *ClientPool) candidates() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order := []int{p.current}
+	for i, node := range p.nodes {
+		if i != p.current && node.healthy {
+			order = append(order, i)
+		}
+	}
+	for i, node := range p.nodes {
+		if i != p.current && !node.healthy {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+//callHealthyNodes 并发请求所有健康的节点，没有健康节点时请求所有节点，返回成功的结果
+func (p *ClientPool) callHealthyNodes(ctx context.Context, path string, request []interface{}) ([]*gjson.Result, error) {
+
+	p.checkHealthIfExpired(ctx)
+
+	p.mu.Lock()
+	clients := make([]*Client, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		if node.healthy {
+			clients = append(clients, node.client)
+		}
+	}
+	if len(clients) == 0 {
+		for _, node := range p.nodes {
+			clients = append(clients, node.client)
+		}
+	}
+	p.mu.Unlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lastErr error
+		results = make([]*gjson.Result, 0, len(clients))
+	)
+
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			result, err := client.CallContext(ctx, path, request)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			results = append(results, result)
+		}(client)
+	}
+
+	wg.Wait()
+
+	if len(results) == 0 {
+		return nil, lastErr
+	}
+
+	return results, nil
+}
+
+//setCurrent 请求成功后设置当前节点，当前节点健康时不切换到不健康的节点。
+//请求成功不代表节点已同步，不健康的节点只能通过CheckHealth恢复。
+func (p *ClientPool) setCurrent(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nodes[i].healthy || !p.nodes[p.current].healthy {
+		p.current = i
+	}
+}
+
+//setUnhealthy 节点请求失败，标记为不健康
+func (p *ClientPool) setUnhealthy(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nodes[i].healthy = false
+	p.nodes[i].lastError = err
+	if len(p.nodes) > 1 {
+		log.Std.Warning("node: %s is unavailable, %v", p.nodes[i].client.BaseURL, err)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientPool_Failover(t *testing.T) {
+	down, downHits := testRPCServer(100, `"result":1`)
+	defer down.Close()
+	up, upHits := testRPCServer(0, `"result":100`)
+	defer up.Close()
+
+	pool := NewClientPool(ParseServerAPIs(down.URL+", "+up.URL), false)
+	pool.HealthCheckInterval = 0
+	for _, client := range pool.Clients() {
+		client.MaxRetries = 1
+		client.RetryBackoff = time.Millisecond
+	}
+
+	result, err := pool.Call("GetBlockCount", nil)
+	if err != nil {
+		t.Errorf("Call failed unexpected error: %v", err)
+		return
+	}
+	if result.Int() != 100 || pool.Current().BaseURL != up.URL {
+		t.Errorf("result: %s, current: %s", result.String(), pool.Current().BaseURL)
+	}
+
+	//切换后不再请求不可用的节点
+	if _, err = pool.Call("GetBlockCount", nil); err != nil {
+		t.Errorf("Call failed unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(downHits) != 2 || atomic.LoadInt32(upHits) != 2 {
+		t.Errorf("down requests: %d, up requests: %d", atomic.LoadInt32(downHits), atomic.LoadInt32(upHits))
+	}
+}
+
+func TestClientPool_Quorum(t *testing.T) {
+	nodeA, _ := testRPCServer(0, `"result":101`)
+	defer nodeA.Close()
+	nodeB, _ := testRPCServer(0, `"result":100`)
+	defer nodeB.Close()
+	nodeC, _ := testRPCServer(0, `"result":99`)
+	defer nodeC.Close()
+
+	pool := NewClientPool([]string{nodeA.URL, nodeB.URL, nodeC.URL}, false)
+	pool.HealthCheckInterval = 0
+	pool.Quorum = 2
+
+	height, err := pool.QuorumBlockCount(context.Background())
+	if err != nil {
+		t.Errorf("QuorumBlockCount failed unexpected error: %v", err)
+		return
+	}
+	if height != 100 {
+		t.Errorf("quorum height: %d", height)
+	}
+
+	//三个节点结果都不一致
+	if _, err = pool.QuorumCall(context.Background(), "GetBlockHash", []interface{}{100}); err == nil {
+		t.Errorf("QuorumCall should be failed")
+	}
+}
+
+func TestClientPool_CheckHealth(t *testing.T) {
+	behind := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":{"isRunning":true,"connections":8,"localLastBlockHeight":90,"remoteLatestBlockHeight":100}}`))
+	}))
+	defer behind.Close()
+	synced := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":{"isRunning":true,"connections":8,"localLastBlockHeight":100,"remoteLatestBlockHeight":100}}`))
+	}))
+	defer synced.Close()
+
+	pool := NewClientPool([]string{behind.URL, synced.URL}, false)
+	pool.CheckHealth(context.Background())
+
+	if pool.Current().BaseURL != synced.URL {
+		t.Errorf("current node should be the synced node: %s", pool.Current().BaseURL)
+	}
+}
+
+func TestClientPool_UnhealthyUntilCheckHealth(t *testing.T) {
+	down, _ := testRPCServer(100, `"result":1`)
+	defer down.Close()
+
+	//落后的节点可以响应请求，但不能通过健康检查
+	var synced int32
+	behind := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		id := gjson.GetBytes(body, "id").String()
+		if gjson.GetBytes(body, "method").String() != "GetBlockChainInfo" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":"` + id + `","result":90}`))
+			return
+		}
+		height := 90
+		if atomic.LoadInt32(&synced) == 1 {
+			height = 100
+		}
+		w.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"%s","result":{"isRunning":true,"connections":8,"localLastBlockHeight":%d,"remoteLatestBlockHeight":100}}`, id, height)))
+	}))
+	defer behind.Close()
+
+	pool := NewClientPool([]string{down.URL, behind.URL}, false)
+	pool.HealthCheckInterval = 0
+	for _, client := range pool.Clients() {
+		client.MaxRetries = 1
+		client.RetryBackoff = time.Millisecond
+	}
+	pool.CheckHealth(context.Background())
+
+	isHealthy := func(i int) bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return pool.nodes[i].healthy
+	}
+
+	//请求成功不能恢复节点的健康状态
+	result, err := pool.Call("GetBlockCount", nil)
+	if err != nil || result.Int() != 90 {
+		t.Errorf("Call result: %v, error: %v", result, err)
+	}
+	if isHealthy(1) {
+		t.Errorf("behind node should stay unhealthy after a successful call")
+	}
+
+	atomic.StoreInt32(&synced, 1)
+	pool.CheckHealth(context.Background())
+	if !isHealthy(1) || isHealthy(0) || pool.Current().BaseURL != behind.URL {
+		t.Errorf("synced node should be healthy and current after CheckHealth, current: %s", pool.Current().BaseURL)
+	}
+}
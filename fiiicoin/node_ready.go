@@ -0,0 +1,104 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	//默认节点时间偏差TimeOffset允许的最大值
+	defaultNodeMaxTimeOffset = 30 * time.Minute
+)
+
+const (
+	NodeNotRunning     = "not_running"  //P2P网络没有运行
+	NodeNoConnections  = "no_peers"     //没有连接其他节点
+	NodeBehindNetwork  = "lagging"      //本地区块高度落后网络
+	NodeTimeOffsetHigh = "clock_offset" //节点时间与网络相差太大
+)
+
+//NodeNotReadyError 节点未同步完成，不能扫块和广播交易单
+type NodeNotReadyError struct {
+	Reason string //未就绪的原因，NodeNotRunning等
+	Info   *BlockchainInfo
+	detail string
+}
+
+func (e *NodeNotReadyError) Error() string {
+	return fmt.Sprintf("node is not ready: %s", e.detail)
+}
+
+//IsNodeNotReady 是否节点未就绪的错误
+func IsNodeNotReady(err error) bool {
+	_, ok := err.(*NodeNotReadyError)
+	return ok
+}
+
+//checkNodeReadiness 节点需要正在运行、有连接、落后网络不超过maxBlockLag，并且时间差不超过maxTimeOffset，maxTimeOffset为0不检查
+func checkNodeReadiness(info *BlockchainInfo, maxBlockLag uint64, maxTimeOffset time.Duration) error {
+
+	notReady := func(reason, format string, args ...interface{}) error {
+		return &NodeNotReadyError{Reason: reason, Info: info, detail: fmt.Sprintf(format, args...)}
+	}
+
+	if !info.IsRunning {
+		return notReady(NodeNotRunning, "node is not running")
+	}
+	if info.Connections == 0 {
+		return notReady(NodeNoConnections, "node has no connections")
+	}
+	if info.RemoteLatestBlockHeight > info.LocalLastBlockHeight+maxBlockLag {
+		return notReady(NodeBehindNetwork, "node local block height: %d is behind the network: %d", info.LocalLastBlockHeight, info.RemoteLatestBlockHeight)
+	}
+
+	//TimeOffset为毫秒
+	offset := time.Duration(info.TimeOffset) * time.Millisecond
+	if offset < 0 {
+		offset = -offset
+	}
+	if maxTimeOffset > 0 && offset > maxTimeOffset {
+		return notReady(NodeTimeOffsetHigh, "node time offset: %v is greater than: %v", offset, maxTimeOffset)
+	}
+
+	return nil
+}
+
+//CheckNodeReady 检查当前节点是否已就绪，返回节点的区块链信息
+func (wm *WalletManager) CheckNodeReady() (*BlockchainInfo, error) {
+
+	info, err := wm.GetBlockChainInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNodeReadiness(info, wm.Config.NodeMaxBlockLag, wm.Config.NodeMaxTimeOffset)
+	if err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+//checkNodeReadyIfEnabled 配置了nodeReadyCheck时检查节点
+func (wm *WalletManager) checkNodeReadyIfEnabled() error {
+	if !wm.Config.NodeReadyCheck {
+		return nil
+	}
+	_, err := wm.CheckNodeReady()
+	return err
+}
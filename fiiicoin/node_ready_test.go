@@ -0,0 +1,74 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/tidwall/gjson"
+	"testing"
+	"time"
+)
+
+func TestCheckNodeReadiness(t *testing.T) {
+	tests := []struct {
+		info   BlockchainInfo
+		reason string
+	}{
+		{BlockchainInfo{IsRunning: true, Connections: 8, LocalLastBlockHeight: 100, RemoteLatestBlockHeight: 103}, ""},
+		{BlockchainInfo{IsRunning: false, Connections: 8}, NodeNotRunning},
+		{BlockchainInfo{IsRunning: true, Connections: 0}, NodeNoConnections},
+		{BlockchainInfo{IsRunning: true, Connections: 8, LocalLastBlockHeight: 100, RemoteLatestBlockHeight: 104}, NodeBehindNetwork},
+		{BlockchainInfo{IsRunning: true, Connections: 8, TimeOffset: -3600000}, NodeTimeOffsetHigh},
+	}
+
+	for i, test := range tests {
+		err := checkNodeReadiness(&test.info, 3, 30*time.Minute)
+		if len(test.reason) == 0 {
+			if err != nil {
+				t.Errorf("case %d should be ready, got: %v", i, err)
+			}
+			continue
+		}
+		notReady, ok := err.(*NodeNotReadyError)
+		if !ok || notReady.Reason != test.reason {
+			t.Errorf("case %d should not be ready by: %s, got: %v", i, test.reason, err)
+			continue
+		}
+		t.Logf("case %d: %v", i, err)
+	}
+}
+
+func TestWalletManager_CheckNodeReady(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	wm := testMockWalletManager(node)
+	if _, err := wm.CheckNodeReady(); err != nil {
+		t.Errorf("mock node should be ready, got: %v", err)
+		return
+	}
+
+	node.SetHandler("GetBlockChainInfo", func(params []gjson.Result) (interface{}, error) {
+		return map[string]interface{}{"isRunning": true, "connections": 0}, nil
+	})
+	if _, err := wm.CheckNodeReady(); !IsNodeNotReady(err) {
+		t.Errorf("node without peers should not be ready, got: %v", err)
+	}
+
+	wm.Config.NodeReadyCheck = false
+	if err := wm.checkNodeReadyIfEnabled(); err != nil {
+		t.Errorf("disabled check should pass, got: %v", err)
+	}
+}
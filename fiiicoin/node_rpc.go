@@ -0,0 +1,268 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+)
+
+//NodeAPI FIII节点RPC接口的类型化封装
+type NodeAPI struct {
+	client ClientInterface
+}
+
+//NewNodeAPI 使用节点客户端或节点池创建
+func NewNodeAPI(client ClientInterface) *NodeAPI {
+	return &NodeAPI{client: client}
+}
+
+//call 请求节点，result不为nil时把结果解析到result
+func (api *NodeAPI) call(ctx context.Context, method string, params []interface{}, result interface{}) (*gjson.Result, error) {
+
+	r, err := api.client.CallContext(ctx, method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if result != nil && r.Type != gjson.Null {
+		err = json.Unmarshal([]byte(r.Raw), result)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s result failed, unexpected error: %v", method, err)
+		}
+	}
+
+	return r, nil
+}
+
+//////////////////////// 区块链 ////////////////////////
+
+//GetBlockChainInfo 节点区块链信息
+func (api *NodeAPI) GetBlockChainInfo(ctx context.Context) (*BlockchainInfo, error) {
+	r, err := api.call(ctx, "GetBlockChainInfo", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockchainInfo(r), nil
+}
+
+//GetBlockCount 区块高度
+func (api *NodeAPI) GetBlockCount(ctx context.Context) (uint64, error) {
+	var height uint64
+	_, err := api.call(ctx, "GetBlockCount", nil, &height)
+	return height, err
+}
+
+//GetBlockHash 区块高度对应的区块hash
+func (api *NodeAPI) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	var hash string
+	_, err := api.call(ctx, "GetBlockHash", []interface{}{height}, &hash)
+	return hash, err
+}
+
+//GetBlock 区块数据
+func (api *NodeAPI) GetBlock(ctx context.Context, hash string) (*Block, error) {
+	r, err := api.call(ctx, "GetBlock", []interface{}{hash, 1}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlock(r), nil
+}
+
+//GetTxOut 交易单输出，已花费时返回nil
+func (api *NodeAPI) GetTxOut(ctx context.Context, txid string, vout uint64) (*TxOut, error) {
+	var out *TxOut
+	_, err := api.call(ctx, "GetTxOut", []interface{}{txid, vout}, &out)
+	return out, err
+}
+
+//////////////////////// 交易池 ////////////////////////
+
+//GetAllTxInMemPool 交易池中的所有交易单ID
+func (api *NodeAPI) GetAllTxInMemPool(ctx context.Context) ([]string, error) {
+	r, err := api.call(ctx, "GetAllTxInMemPool", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsArray() {
+		return nil, fmt.Errorf("no query record")
+	}
+	txids := make([]string, 0)
+	for _, txid := range r.Array() {
+		txids = append(txids, txid.String())
+	}
+	return txids, nil
+}
+
+//GetMemPoolInfo 交易池信息
+func (api *NodeAPI) GetMemPoolInfo(ctx context.Context) (*MemPoolInfo, error) {
+	info := &MemPoolInfo{}
+	_, err := api.call(ctx, "GetMemPoolInfo", nil, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+//////////////////////// 交易单 ////////////////////////
+
+//GetTransaction 交易单详情
+func (api *NodeAPI) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	r, err := api.call(ctx, "GetTransaction", []interface{}{txid}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newTxByCore(r), nil
+}
+
+//ListTransactions 节点钱包的交易记录，account为空时查询所有账户
+func (api *NodeAPI) ListTransactions(ctx context.Context, account string, count, skip int) ([]*TransactionHistory, error) {
+	if len(account) == 0 {
+		account = "*"
+	}
+	txs := make([]*TransactionHistory, 0)
+	_, err := api.call(ctx, "ListTransactions", []interface{}{account, count, skip}, &txs)
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+//ListUnspent 未花记录，addresses为空时查询节点钱包所有地址
+func (api *NodeAPI) ListUnspent(ctx context.Context, min, max uint64, addresses ...string) ([]*Unspent, error) {
+	params := []interface{}{min, max}
+	if len(addresses) > 0 {
+		params = append(params, addresses)
+	}
+	r, err := api.call(ctx, "ListUnspent", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newUnspents(r), nil
+}
+
+//CreateRawTransaction 节点创建交易单
+func (api *NodeAPI) CreateRawTransaction(ctx context.Context, inputs []*CreateRawTransactionInput, outputs []*CreateRawTransactionOutput, changeAddress string, lockTime int64, feeRate uint64) (*gjson.Result, error) {
+	return api.call(ctx, "CreateRawTransaction", []interface{}{inputs, outputs, changeAddress, lockTime, feeRate}, nil)
+}
+
+//BroadcastTransaction 广播交易单
+func (api *NodeAPI) BroadcastTransaction(ctx context.Context, msg interface{}) error {
+	_, err := api.call(ctx, "BroadcastTransaction", []interface{}{msg}, nil)
+	return err
+}
+
+//EstimateSmartFee 节点预估的每KB费率，最小单位
+func (api *NodeAPI) EstimateSmartFee(ctx context.Context) (string, error) {
+	r, err := api.call(ctx, "EstimateSmartFee", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+//////////////////////// 地址 ////////////////////////
+
+//ValidateAddress 验证地址
+func (api *NodeAPI) ValidateAddress(ctx context.Context, address string) (*ValidateAddressResult, error) {
+	result := &ValidateAddressResult{}
+	_, err := api.call(ctx, "ValidateAddress", []interface{}{address}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//AddWatchOnlyAddress 导入观察地址
+func (api *NodeAPI) AddWatchOnlyAddress(ctx context.Context, publicKey string) error {
+	_, err := api.call(ctx, "AddWatchOnlyAddress", []interface{}{publicKey}, nil)
+	return err
+}
+
+//ExportAddresses 导出节点钱包的地址
+func (api *NodeAPI) ExportAddresses(ctx context.Context) ([]*AddressInfo, error) {
+	r, err := api.call(ctx, "ExportAddresses", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	//节点把地址列表编码为json字符串返回
+	raw := r.Raw
+	if r.Type == gjson.String {
+		raw = r.String()
+	}
+	addresses := make([]*AddressInfo, 0)
+	err = json.Unmarshal([]byte(raw), &addresses)
+	if err != nil {
+		return nil, fmt.Errorf("decode ExportAddresses result failed, unexpected error: %v", err)
+	}
+	return addresses, nil
+}
+
+//GetAddressesByTag 标签下的地址
+func (api *NodeAPI) GetAddressesByTag(ctx context.Context, tag string) ([]string, error) {
+	addresses := make([]string, 0)
+	_, err := api.call(ctx, "GetAddressesByTag", []interface{}{tag}, &addresses)
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+//GetAccountByAddress 地址对应的账户
+func (api *NodeAPI) GetAccountByAddress(ctx context.Context, address string) (*AccountInfo, error) {
+	account := &AccountInfo{}
+	_, err := api.call(ctx, "GetAccountByAddress", []interface{}{address}, account)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+//////////////////////// 网络 ////////////////////////
+
+//GetPeerInfo 连接的节点信息
+func (api *NodeAPI) GetPeerInfo(ctx context.Context) ([]*PeerInfo, error) {
+	peers := make([]*PeerInfo, 0)
+	_, err := api.call(ctx, "GetPeerInfo", nil, &peers)
+	if err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+//GetConnectionCount 连接的节点数量
+func (api *NodeAPI) GetConnectionCount(ctx context.Context) (uint64, error) {
+	var count uint64
+	_, err := api.call(ctx, "GetConnectionCount", nil, &count)
+	return count, err
+}
+
+//GetMiningInfo 挖矿信息
+func (api *NodeAPI) GetMiningInfo(ctx context.Context) (*MiningInfo, error) {
+	info := &MiningInfo{}
+	_, err := api.call(ctx, "GetMiningInfo", nil, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+//NodeAPI 节点RPC接口
+func (wm *WalletManager) NodeAPI() *NodeAPI {
+	return NewNodeAPI(wm.WalletClient)
+}
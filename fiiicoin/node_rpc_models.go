@@ -0,0 +1,173 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"encoding/json"
+	"github.com/tidwall/gjson"
+)
+
+//FIII节点RPC接口的请求和响应结构，解析时不区分大小写。
+//字段名按FIII节点的命名（输出脚本为LockScript，地址见models.go中交易单的解析），
+//未经节点实际返回核对的字段在UnmarshalJSON中兼容旧的比特币风格字段名
+
+//TxOut 未花费的交易单输出
+type TxOut struct {
+	BestBlock     string `json:"BestBlock"`     //当前最新区块hash
+	Confirmations uint64 `json:"Confirmations"` //确认数
+	Value         uint64 `json:"Value"`         //数量，最小单位
+	LockScript    string `json:"LockScript"`    //锁定脚本
+	IsCoinbase    bool   `json:"Coinbase"`      //是否挖矿奖励
+}
+
+//UnmarshalJSON 解析TxOut，兼容ScriptPubKey
+func (out *TxOut) UnmarshalJSON(data []byte) error {
+	type txOut TxOut
+	if err := json.Unmarshal(data, (*txOut)(out)); err != nil {
+		return err
+	}
+	if len(out.LockScript) == 0 {
+		out.LockScript = gjson.GetBytes(data, "ScriptPubKey").String()
+	}
+	return nil
+}
+
+//MemPoolInfo 交易池信息
+type MemPoolInfo struct {
+	Size          uint64 `json:"Size"`          //交易单数量
+	Bytes         uint64 `json:"Bytes"`         //交易单总大小
+	Usage         uint64 `json:"Usage"`         //占用的内存
+	MaxMemPool    uint64 `json:"MaxMemPool"`    //最大内存
+	MemPoolMinFee uint64 `json:"MemPoolMinFee"` //进入交易池的最低每KB费率，最小单位
+}
+
+//PeerInfo 连接的节点信息
+type PeerInfo struct {
+	ID              int64  `json:"Id"`
+	Address         string `json:"Address"`         //节点地址
+	IsInbound       bool   `json:"IsInbound"`       //是否对方发起的连接
+	Version         int64  `json:"Version"`         //协议版本
+	LastSend        int64  `json:"LastSend"`        //最后发送时间
+	LastReceive     int64  `json:"LastRecv"`        //最后接收时间
+	ConnectedTime   int64  `json:"ConnectedTime"`   //连接时间
+	LatestHeight    uint64 `json:"LatestHeight"`    //对方的最新区块高度
+	BytesSent       uint64 `json:"BytesSent"`       //发送的字节数
+	BytesReceived   uint64 `json:"BytesRecv"`       //接收的字节数
+	PingTime        int64  `json:"PingTime"`        //延迟，毫秒
+	IsTrackerServer bool   `json:"IsTrackerServer"` //是否跟踪服务器
+}
+
+//UnmarshalJSON 解析PeerInfo，兼容Addr、Inbound、ConnTime
+func (peer *PeerInfo) UnmarshalJSON(data []byte) error {
+	type peerInfo PeerInfo
+	if err := json.Unmarshal(data, (*peerInfo)(peer)); err != nil {
+		return err
+	}
+	if len(peer.Address) == 0 {
+		peer.Address = gjson.GetBytes(data, "Addr").String()
+	}
+	if !peer.IsInbound {
+		peer.IsInbound = gjson.GetBytes(data, "Inbound").Bool()
+	}
+	if peer.ConnectedTime == 0 {
+		peer.ConnectedTime = gjson.GetBytes(data, "ConnTime").Int()
+	}
+	return nil
+}
+
+//MiningInfo 挖矿信息
+type MiningInfo struct {
+	Blocks               uint64  `json:"Blocks"`           //区块高度
+	CurrentBlockTx       uint64  `json:"CurrentBlockTx"`   //最新区块的交易单数量
+	CurrentBlockSize     uint64  `json:"CurrentBlockSize"` //最新区块的大小
+	Difficulty           float64 `json:"Difficulty"`       //当前难度
+	NetworkHashPerSecond float64 `json:"NetworkHashps"`    //全网算力
+	PooledTx             uint64  `json:"PooledTx"`         //交易池中的交易单数量
+	Chain                string  `json:"Chain"`            //网络类型
+}
+
+//ValidateAddressResult 地址验证结果
+type ValidateAddressResult struct {
+	IsValid     bool   `json:"IsValid"`     //地址是否有效
+	Address     string `json:"Address"`     //地址
+	LockScript  string `json:"LockScript"`  //地址的锁定脚本
+	IsMine      bool   `json:"IsMine"`      //是否节点钱包的地址
+	IsWatchOnly bool   `json:"IsWatchOnly"` //是否节点钱包的观察地址
+	IsScript    bool   `json:"IsScript"`    //是否脚本地址
+	PubKey      string `json:"PubKey"`      //地址公钥
+	Account     string `json:"Account"`     //地址所属的账户
+}
+
+//UnmarshalJSON 解析ValidateAddressResult，兼容ScriptPubKey
+func (result *ValidateAddressResult) UnmarshalJSON(data []byte) error {
+	type validateAddressResult ValidateAddressResult
+	if err := json.Unmarshal(data, (*validateAddressResult)(result)); err != nil {
+		return err
+	}
+	if len(result.LockScript) == 0 {
+		result.LockScript = gjson.GetBytes(data, "ScriptPubKey").String()
+	}
+	return nil
+}
+
+//TransactionHistory 节点钱包的交易记录
+type TransactionHistory struct {
+	Account       string `json:"Account"`       //账户
+	Address       string `json:"Address"`       //地址
+	Category      string `json:"Category"`      //类型，send或receive
+	Amount        int64  `json:"Amount"`        //数量，最小单位，发送为负数
+	Vout          uint64 `json:"Vout"`          //输出序号
+	Fee           int64  `json:"Fee"`           //手续费，最小单位
+	Confirmations uint64 `json:"Confirmations"` //确认数
+	BlockHash     string `json:"BlockHash"`     //所在区块hash
+	BlockIndex    uint64 `json:"BlockIndex"`    //在区块中的序号
+	BlockTime     int64  `json:"BlockTime"`     //区块时间
+	TxID          string `json:"TxId"`          //交易单ID
+	Time          int64  `json:"Time"`          //交易单时间
+	TimeReceived  int64  `json:"TimeReceived"`  //节点收到交易单的时间
+	Comment       string `json:"Comment"`       //备注
+}
+
+//CreateRawTransactionInput CreateRawTransaction的输入
+type CreateRawTransactionInput struct {
+	TxID string `json:"Txid"`
+	Vout uint64 `json:"Vout"`
+}
+
+//CreateRawTransactionOutput CreateRawTransaction的输出
+type CreateRawTransactionOutput struct {
+	Address string `json:"Address"`
+	Amount  uint64 `json:"Amount"`
+}
+
+//AddressInfo ExportAddresses返回的地址
+type AddressInfo struct {
+	ID        string `json:"Id"`        //地址
+	PublicKey string `json:"PublicKey"` //公钥
+	Tag       string `json:"Tag"`       //标签
+	IsDefault bool   `json:"IsDefault"` //是否默认地址
+	WatchOnly bool   `json:"WatchedOnly"`
+}
+
+//AccountInfo GetAccountByAddress返回的账户
+type AccountInfo struct {
+	ID        string `json:"Id"`        //地址
+	PublicKey string `json:"PublicKey"` //公钥
+	Balance   uint64 `json:"Balance"`   //余额，最小单位
+	Tag       string `json:"Tag"`       //标签
+	IsDefault bool   `json:"IsDefault"` //是否默认地址
+	WatchOnly bool   `json:"WatchedOnly"`
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//testNodeAPIServer 按方法返回结果的节点
+func testNodeAPIServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := gjson.ParseBytes(body)
+		result, ok := results[req.Get("method").String()]
+		if !ok {
+			result = `"error":{"code":-32601,"message":"Method not found"}`
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"` + req.Get("id").String() + `",` + result + `}`))
+	}))
+}
+
+func TestNodeAPI(t *testing.T) {
+	server := testNodeAPIServer(map[string]string{
+		"GetMemPoolInfo":  `"result":{"Size":2,"Bytes":500,"Usage":1024}`,
+		"GetTxOut":        `"result":null`,
+		"GetPeerInfo":     `"result":[{"Id":1,"Address":"127.0.0.1:58011","IsInbound":true,"Version":1,"LatestHeight":100},{"Id":2,"Addr":"127.0.0.1:58012","Inbound":true,"ConnTime":1560000000}]`,
+		"ValidateAddress": `"result":{"IsValid":true,"Address":"fiiitCPyohiEPn9q11AXCdvVDouoVvgojXBcVj","ScriptPubKey":"76A914"}`,
+		"ExportAddresses": `"result":"[{\"Id\":\"fiiitCPyohiEPn9q11AXCdvVDouoVvgojXBcVj\",\"WatchedOnly\":true}]"`,
+	})
+	defer server.Close()
+
+	api := NewNodeAPI(NewClient(server.URL, false))
+	ctx := context.Background()
+
+	info, err := api.GetMemPoolInfo(ctx)
+	if err != nil || info.Size != 2 {
+		t.Errorf("GetMemPoolInfo unexpected result: %+v, error: %v", info, err)
+	}
+
+	out, err := api.GetTxOut(ctx, "txid", 0)
+	if err != nil || out != nil {
+		t.Errorf("GetTxOut of spent output should be nil: %+v, error: %v", out, err)
+	}
+
+	peers, err := api.GetPeerInfo(ctx)
+	if err != nil || len(peers) != 2 || peers[0].LatestHeight != 100 || peers[0].Address != "127.0.0.1:58011" || !peers[0].IsInbound {
+		t.Errorf("GetPeerInfo unexpected result: %+v, error: %v", peers, err)
+	} else if peers[1].Address != "127.0.0.1:58012" || !peers[1].IsInbound || peers[1].ConnectedTime != 1560000000 {
+		t.Errorf("GetPeerInfo should accept Addr/Inbound/ConnTime: %+v", peers[1])
+	}
+
+	valid, err := api.ValidateAddress(ctx, "fiiitCPyohiEPn9q11AXCdvVDouoVvgojXBcVj")
+	if err != nil || !valid.IsValid || valid.LockScript != "76A914" {
+		t.Errorf("ValidateAddress unexpected result: %+v, error: %v", valid, err)
+	}
+
+	addresses, err := api.ExportAddresses(ctx)
+	if err != nil || len(addresses) != 1 || !addresses[0].WatchOnly {
+		t.Errorf("ExportAddresses unexpected result: %+v, error: %v", addresses, err)
+	}
+
+	_, err = api.GetMiningInfo(ctx)
+	if !IsRPCErrorCode(err, -32601) {
+		t.Errorf("GetMiningInfo should return rpc error, got: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//ErrRateLimited 等待的请求超过限制，请求被拒绝
+var ErrRateLimited = errors.New("too many node requests are waiting")
+
+//RateLimiter 节点请求的令牌桶限流和并发限制，每个节点客户端一个
+type RateLimiter struct {
+	rate        float64 //每秒令牌数，0不限流
+	burst       float64 //令牌桶容量
+	maxInFlight int     //同时进行的最大请求数，0不限制
+	maxQueued   int64   //等待中的最大请求数，0不限制
+	inFlight    chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	waiting     int64
+	running     int64
+	totalQueued uint64
+	rejected    uint64
+	completed   uint64
+}
+
+//LimiterStats 限流器的统计数据
+type LimiterStats struct {
+	InFlight    int64  //正在进行的请求数
+	Waiting     int64  //正在等待令牌或并发名额的请求数
+	TotalQueued uint64 //需要等待才能发送的请求总数
+	Rejected    uint64 //因等待的请求过多或等待时ctx结束而放弃的请求总数
+	Completed   uint64 //已发送的请求总数
+}
+
+//NewRateLimiter 创建限流器，burst小于1时为max(1, rate)
+func NewRateLimiter(rate float64, burst, maxInFlight, maxQueued int) *RateLimiter {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	limiter := &RateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		maxInFlight: maxInFlight,
+		maxQueued:   int64(maxQueued),
+		tokens:      float64(burst),
+		last:        time.Now(),
+	}
+	if maxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return limiter
+}
+
+//Acquire 等待n个令牌和一个并发名额，成功后需要调用release。
+//批量请求按请求数消耗令牌，超过容量时按容量计算。
+func (l *RateLimiter) Acquire(ctx context.Context, n int) (release func(), err error) {
+
+	if l.maxQueued > 0 && atomic.LoadInt64(&l.waiting) >= l.maxQueued {
+		atomic.AddUint64(&l.rejected, 1)
+		return nil, ErrRateLimited
+	}
+
+	atomic.AddInt64(&l.waiting, 1)
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	queued := false
+
+	if wait := l.reserve(n); wait > 0 {
+		queued = true
+		atomic.AddUint64(&l.totalQueued, 1)
+		select {
+		case <-ctx.Done():
+			l.cancel(n)
+			atomic.AddUint64(&l.rejected, 1)
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			if !queued {
+				atomic.AddUint64(&l.totalQueued, 1)
+			}
+			select {
+			case <-ctx.Done():
+				atomic.AddUint64(&l.rejected, 1)
+				return nil, ctx.Err()
+			case l.inFlight <- struct{}{}:
+			}
+		}
+	}
+
+	atomic.AddInt64(&l.running, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&l.running, -1)
+			atomic.AddUint64(&l.completed, 1)
+			if l.inFlight != nil {
+				<-l.inFlight
+			}
+		})
+	}, nil
+}
+
+//Stats 统计数据
+func (l *RateLimiter) Stats() *LimiterStats {
+	return &LimiterStats{
+		InFlight:    atomic.LoadInt64(&l.running),
+		Waiting:     atomic.LoadInt64(&l.waiting),
+		TotalQueued: atomic.LoadUint64(&l.totalQueued),
+		Rejected:    atomic.LoadUint64(&l.rejected),
+		Completed:   atomic.LoadUint64(&l.completed),
+	}
+}
+
+//reserve 预留令牌，返回需要等待的时间
+func (l *RateLimiter) reserve(n int) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	cost := l.cost(n)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	//令牌可以为负，表示已预留给等待中的请求
+	l.tokens -= cost
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+//cancel 放弃等待时归还预留的令牌
+func (l *RateLimiter) cancel(n int) {
+	if l.rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.tokens += l.cost(n)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.mu.Unlock()
+}
+
+//cost 消耗的令牌数
+func (l *RateLimiter) cost(n int) float64 {
+	cost := float64(n)
+	if cost < 1 {
+		cost = 1
+	}
+	if cost > l.burst {
+		cost = l.burst
+	}
+	return cost
+}
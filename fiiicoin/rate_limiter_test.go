@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Rate(t *testing.T) {
+	limiter := NewRateLimiter(20, 2, 0, 0)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		release, err := limiter.Acquire(context.Background(), 1)
+		if err != nil {
+			t.Errorf("Acquire failed unexpected error: %v", err)
+			return
+		}
+		release()
+	}
+
+	//前2个使用桶中的令牌，后2个各等待50ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 calls with rate 20/s and burst 2 elapsed: %v", elapsed)
+	}
+
+	stats := limiter.Stats()
+	if stats.TotalQueued != 2 || stats.Completed != 4 || stats.InFlight != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	//ctx结束时放弃等待
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, 2); err == nil {
+		t.Errorf("Acquire should be canceled")
+	}
+	if limiter.Stats().Rejected != 1 {
+		t.Errorf("canceled call should be rejected")
+	}
+}
+
+func TestClient_SetRateLimit(t *testing.T) {
+	var (
+		running int32
+		maxSeen int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":100}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.SetRateLimit(0, 0, 2, 3)
+
+	var (
+		wg       sync.WaitGroup
+		rejected int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			//响应没有id，不检查结果
+			_, err := client.Call("GetBlockCount", nil)
+			if err == ErrRateLimited {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := client.LimiterStats()
+	t.Logf("stats: %+v", stats)
+	if atomic.LoadInt32(&maxSeen) > 2 {
+		t.Errorf("max in flight: %d, want 2", maxSeen)
+	}
+	if rejected == 0 || uint64(rejected) != stats.Rejected {
+		t.Errorf("rejected: %d, stats: %+v", rejected, stats)
+	}
+	if stats.Completed+stats.Rejected != 8 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
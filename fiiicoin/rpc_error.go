@@ -0,0 +1,122 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"context"
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//FIII节点沿用的json-rpc错误码
+const (
+	//json-rpc标准错误
+	RPCErrInvalidRequest = -32600
+	RPCErrMethodNotFound = -32601
+	RPCErrInvalidParams  = -32602
+	RPCErrInternal       = -32603
+	RPCErrParse          = -32700
+
+	//节点通用错误
+	RPCErrMisc                 = -1  //未知错误
+	RPCErrType                 = -3  //参数类型错误
+	RPCErrInvalidAddressOrKey  = -5  //地址、私钥或交易单不存在
+	RPCErrOutOfMemory          = -7  //内存不足
+	RPCErrInvalidParameter     = -8  //参数错误，如区块高度超出范围
+	RPCErrClientNotConnected   = -9  //节点没有连接
+	RPCErrClientInInitialSync  = -10 //节点正在同步区块
+	RPCErrDatabase             = -20 //数据库错误
+	RPCErrDeserialization      = -22 //交易单或区块解析失败
+	RPCErrVerify               = -25 //交易单或区块验证失败
+	RPCErrVerifyRejected       = -26 //交易单被交易池拒绝
+	RPCErrVerifyAlreadyInChain = -27 //交易单已在链上
+	RPCErrInWarmup             = -28 //节点正在启动
+)
+
+//rpcErrorCodes 节点错误码对应的openwallet错误码，没有对应的使用调用方指定的错误码
+var rpcErrorCodes = map[int64]uint64{
+	RPCErrInvalidRequest:      openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrMethodNotFound:      openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrInternal:            openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrParse:               openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrOutOfMemory:         openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrClientNotConnected:  openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrClientInInitialSync: openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrDatabase:            openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrInWarmup:            openwallet.ErrCallFullNodeAPIFailed,
+	RPCErrDeserialization:     openwallet.ErrSubmitRawTransactionFailed,
+	RPCErrVerify:              openwallet.ErrSubmitRawTransactionFailed,
+	RPCErrVerifyRejected:      openwallet.ErrSubmitRawTransactionFailed,
+}
+
+//RPCError 节点返回的json-rpc错误
+type RPCError struct {
+	Method  string
+	Code    int64
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.Code, e.Message)
+}
+
+//AsRPCError 是否节点返回的json-rpc错误
+func AsRPCError(err error) (*RPCError, bool) {
+	rpcErr, ok := err.(*RPCError)
+	return rpcErr, ok
+}
+
+//IsRPCErrorCode 是否指定错误码的节点错误
+func IsRPCErrorCode(err error, code int64) bool {
+	rpcErr, ok := AsRPCError(err)
+	return ok && rpcErr.Code == code
+}
+
+//IsNodeUnavailable 节点无法访问或请求超时，与节点返回的错误不同，可以稍后重试
+func IsNodeUnavailable(err error) bool {
+	return isNodeUnavailable(err) || err == context.DeadlineExceeded || err == context.Canceled
+}
+
+//ConvertRPCError 转换为openwallet错误，节点无法访问或未就绪为ErrCallFullNodeAPIFailed，
+//节点返回的错误按错误码转换，没有对应的使用defaultCode
+func ConvertRPCError(err error, defaultCode uint64) *openwallet.Error {
+
+	if err == nil {
+		return nil
+	}
+
+	if owErr, ok := err.(*openwallet.Error); ok {
+		return owErr
+	}
+
+	if IsNodeUnavailable(err) {
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "node is unavailable, %v", err)
+	}
+
+	if IsNodeNotReady(err) {
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "%v", err)
+	}
+
+	if rpcErr, ok := AsRPCError(err); ok {
+		code, exist := rpcErrorCodes[rpcErr.Code]
+		if !exist {
+			code = defaultCode
+		}
+		return openwallet.Errorf(code, "%s failed, %s", rpcErr.Method, rpcErr.Error())
+	}
+
+	return openwallet.NewError(defaultCode, err.Error())
+}
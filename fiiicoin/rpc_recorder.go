@@ -0,0 +1,360 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	记录文件每行一个json-rpc调用，批量请求拆分为多行：
+
+	{"time":1560000000000,"node":"http://127.0.0.1:8332","method":"GetBlockHash","params":[100],"status":200,"response":{"result":"...","error":null},"duration":12}
+
+	response不包含jsonrpc和id，回放时按请求的id重新生成。
+*/
+
+//RPCRecord 一次json-rpc调用的记录
+type RPCRecord struct {
+	Time     int64           `json:"time"` //毫秒时间戳
+	Node     string          `json:"node"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params"`
+	Status   int             `json:"status"`   //http状态码
+	Response json.RawMessage `json:"response"` //没有json-rpc响应时为空
+	Duration int64           `json:"duration"` //请求耗时，毫秒
+}
+
+//RPCRedactFunc 写入前处理记录，可以隐藏地址、金额等敏感数据，返回nil不写入
+type RPCRedactFunc func(record *RPCRecord) *RPCRecord
+
+//RPCRecorder 记录节点的请求和响应，不记录请求头
+type RPCRecorder struct {
+	Redact RPCRedactFunc
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+//recordingTransport 通过next发送请求，并交给recorder记录
+type recordingTransport struct {
+	recorder *RPCRecorder
+	next     http.RoundTripper
+}
+
+//NewRPCRecorder 把记录写入w，节点池的多个客户端可以共用
+func NewRPCRecorder(w io.Writer) *RPCRecorder {
+	return &RPCRecorder{w: w}
+}
+
+//OpenRPCRecorder 把记录追加到文件
+func OpenRPCRecorder(file string) (*RPCRecorder, *os.File, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open record file failed, unexpected error: %v", err)
+	}
+	return NewRPCRecorder(f), f, nil
+}
+
+//Wrap 包装实际发送请求的next，next为nil时使用http.DefaultTransport
+func (rec *RPCRecorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{recorder: rec, next: next}
+}
+
+//RoundTrip 发送请求并记录
+func (rt *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+
+	var reqBody []byte
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = body
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	transport := rt.next
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	start := time.Now()
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	node := request.URL.Scheme + "://" + request.URL.Host + request.URL.Path
+	rt.recorder.write(newRPCRecords(node, start, response.StatusCode, reqBody, respBody))
+
+	return response, nil
+}
+
+//write 写入记录，写入失败不影响请求
+func (rec *RPCRecorder) write(records []*RPCRecord) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	for _, record := range records {
+		if rec.Redact != nil {
+			record = rec.Redact(record)
+			if record == nil {
+				continue
+			}
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		rec.w.Write(append(line, '\n'))
+	}
+}
+
+//newRPCRecords 按id把请求和响应对应起来，批量请求拆分为多条记录
+func newRPCRecords(node string, start time.Time, status int, reqBody, respBody []byte) []*RPCRecord {
+
+	var (
+		records   = make([]*RPCRecord, 0)
+		responses = make(map[string]gjson.Result)
+		reqs      = gjson.ParseBytes(reqBody)
+		resps     = gjson.ParseBytes(respBody)
+		duration  = int64(time.Since(start) / time.Millisecond)
+	)
+
+	if !reqs.IsArray() {
+		reqs = gjson.Parse("[" + reqs.Raw + "]")
+	}
+	if resps.IsObject() {
+		resps = gjson.Parse("[" + resps.Raw + "]")
+	}
+	for _, resp := range resps.Array() {
+		responses[resp.Get("id").String()] = resp
+	}
+
+	for _, r := range reqs.Array() {
+		record := &RPCRecord{
+			Time:     start.UnixNano() / int64(time.Millisecond),
+			Node:     node,
+			Method:   r.Get("method").String(),
+			Params:   rawMessage(r.Get("params")),
+			Status:   status,
+			Duration: duration,
+		}
+		if resp, ok := responses[r.Get("id").String()]; ok {
+			record.Response = rawMessage(gjson.Parse(fmt.Sprintf(`{"result":%s,"error":%s}`,
+				rawOrNull(resp.Get("result")), rawOrNull(resp.Get("error")))))
+		}
+		records = append(records, record)
+	}
+
+	return records
+}
+
+//ReplayTransport 回放记录的http.RoundTripper，按方法和参数返回记录的响应。
+//相同的调用有多条记录时按记录顺序返回，用完后一直返回最后一条。
+type ReplayTransport struct {
+	mu      sync.Mutex
+	records map[string][]*RPCRecord
+}
+
+//NewReplayTransport 从r读取记录
+func NewReplayTransport(r io.Reader) (*ReplayTransport, error) {
+
+	replay := &ReplayTransport{
+		records: make(map[string][]*RPCRecord),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		record := &RPCRecord{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			return nil, fmt.Errorf("invalid record at line: %d, unexpected error: %v", n, err)
+		}
+		key := replayKey(record.Method, gjson.ParseBytes(record.Params))
+		replay.records[key] = append(replay.records[key], record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
+
+//LoadReplayTransport 从记录文件读取
+func LoadReplayTransport(file string) (*ReplayTransport, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open replay file failed, unexpected error: %v", err)
+	}
+	defer f.Close()
+	return NewReplayTransport(f)
+}
+
+//RoundTrip 返回记录的响应，没有记录的调用返回json-rpc错误
+func (replay *ReplayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+
+	var body []byte
+	if request.Body != nil {
+		b, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	var (
+		reqs      = gjson.ParseBytes(body)
+		isBatch   = reqs.IsArray()
+		status    = http.StatusOK
+		responses = make([]json.RawMessage, 0)
+	)
+
+	if !isBatch {
+		reqs = gjson.Parse("[" + reqs.Raw + "]")
+	}
+
+	for _, r := range reqs.Array() {
+		record := replay.next(replayKey(r.Get("method").String(), r.Get("params")))
+		if record == nil {
+			responses = append(responses, json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":null,"error":{"code":%d,"message":"no recorded response of %s"}}`,
+				rawOrNull(r.Get("id")), RPCErrMisc, r.Get("method").String())))
+			continue
+		}
+		if record.Status != 0 {
+			status = record.Status
+		}
+		if len(record.Response) == 0 {
+			//记录的是没有json-rpc响应的http错误
+			continue
+		}
+		resp := gjson.ParseBytes(record.Response)
+		responses = append(responses, json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s,"error":%s}`,
+			rawOrNull(r.Get("id")), rawOrNull(resp.Get("result")), rawOrNull(resp.Get("error")))))
+	}
+
+	var respBody []byte
+	if isBatch {
+		respBody, _ = json.Marshal(responses)
+	} else if len(responses) > 0 {
+		respBody = responses[0]
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       request,
+	}, nil
+}
+
+//next 取出调用的下一条记录
+func (replay *ReplayTransport) next(key string) *RPCRecord {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+
+	records := replay.records[key]
+	if len(records) == 0 {
+		return nil
+	}
+	if len(records) > 1 {
+		replay.records[key] = records[1:]
+	}
+	return records[0]
+}
+
+//replayKey 方法和压缩后的参数
+func replayKey(method string, params gjson.Result) string {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, []byte(params.Raw)); err != nil || buf.Len() == 0 || buf.String() == "null" {
+		return method + ":[]"
+	}
+	return method + ":" + buf.String()
+}
+
+//rawMessage gjson结果转为json.RawMessage
+func rawMessage(result gjson.Result) json.RawMessage {
+	if !result.Exists() {
+		return nil
+	}
+	return json.RawMessage(result.Raw)
+}
+
+//rawOrNull 不存在时返回null
+func rawOrNull(result gjson.Result) string {
+	if !result.Exists() {
+		return "null"
+	}
+	return result.Raw
+}
+
+//setupRecording 按配置记录或回放节点池的请求
+func (wm *WalletManager) setupRecording(pool *ClientPool) error {
+
+	if len(wm.Config.RPCReplayFile) > 0 {
+		replay, err := LoadReplayTransport(wm.Config.RPCReplayFile)
+		if err != nil {
+			return err
+		}
+		for _, client := range pool.Clients() {
+			client.SetTransport(replay)
+		}
+		wm.Log.Std.Notice("node calls are replayed from: %s", wm.Config.RPCReplayFile)
+		return nil
+	}
+
+	if len(wm.Config.RPCRecordFile) > 0 {
+		recorder, _, err := OpenRPCRecorder(wm.Config.RPCRecordFile)
+		if err != nil {
+			return err
+		}
+		for _, client := range pool.Clients() {
+			client.SetRecorder(recorder)
+		}
+		wm.Recorder = recorder
+	}
+
+	return nil
+}
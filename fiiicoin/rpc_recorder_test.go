@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRPCRecorder_Replay(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+	_, pay, _ := testMockChain(node)
+
+	buf := &bytes.Buffer{}
+	recorder := NewRPCRecorder(buf)
+	//隐藏地址B
+	recorder.Redact = func(record *RPCRecord) *RPCRecord {
+		record.Response = json.RawMessage(strings.Replace(string(record.Response), mockAddressB, "REDACTED", -1))
+		return record
+	}
+
+	client := node.Client()
+	client.SetRecorder(recorder)
+	wm := testMockWalletManager(node)
+	wm.WalletClient = client
+
+	height, err := wm.GetBlockHeight()
+	if err != nil {
+		t.Errorf("GetBlockHeight failed unexpected error: %v", err)
+		return
+	}
+	if _, err = wm.GetTransactions([]string{pay.Hash, "unknown"}); err != nil {
+		t.Errorf("GetTransactions failed unexpected error: %v", err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Errorf("records: %d, want 3", len(lines))
+		return
+	}
+	if strings.Contains(buf.String(), mockAddressB) {
+		t.Errorf("records should be redacted")
+	}
+	t.Logf("record: %s", lines[0])
+
+	//回放时不连接节点
+	node.Close()
+	replay, err := NewReplayTransport(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Errorf("NewReplayTransport failed unexpected error: %v", err)
+		return
+	}
+	client = NewClient("http://127.0.0.1:0", false)
+	client.SetTransport(replay)
+	wm.WalletClient = client
+
+	replayHeight, err := wm.GetBlockHeight()
+	if err != nil || replayHeight != height {
+		t.Errorf("replay height: %d, error: %v", replayHeight, err)
+	}
+
+	trx, err := wm.GetTransaction(pay.Hash)
+	if err != nil || len(trx.Vouts) != 2 || trx.Vouts[0].Addr != "REDACTED" {
+		t.Errorf("replay transaction: %+v, error: %v", trx, err)
+	}
+
+	if _, err = wm.GetTransaction("unknown"); !IsRPCErrorCode(err, RPCErrInvalidAddressOrKey) {
+		t.Errorf("replay should return the recorded error, got: %v", err)
+	}
+
+	if _, err = wm.GetBlockHash(1); !IsRPCErrorCode(err, RPCErrMisc) {
+		t.Errorf("unrecorded call should return an error, got: %v", err)
+	}
+}
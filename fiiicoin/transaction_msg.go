@@ -0,0 +1,456 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/blocktree/fiiicoin-adapter/fiiicoin_addrdec"
+	"strings"
+	"time"
+)
+
+const (
+	//公钥在解锁脚本中的DER前缀
+	unlockScriptPubKeyPrefix = "302A300506032B6570032100"
+	//解锁脚本中签名的类型标记
+	unlockScriptSigHashAll = "[ALL]"
+	//交易单哈希长度
+	txHashLength = 32
+	//锁定脚本的前后缀
+	lockScriptPrefix = "OP_DUP OP_HASH160 "
+	lockScriptSuffix = " OP_EQUALVERIFY OP_CHECKSIG"
+
+	//ED25519签名和公钥长度
+	signatureLength = 64
+	pubKeyLength    = 32
+	//解锁脚本长度：签名hex + [ALL] + 空格 + DER前缀 + 公钥hex
+	unlockScriptLength = signatureLength*2 + len(unlockScriptSigHashAll) + 1 + len(unlockScriptPubKeyPrefix) + pubKeyLength*2
+	//锁定脚本长度：前缀 + HASH160 hex + 后缀
+	lockScriptLength = len(lockScriptPrefix) + 20*2 + len(lockScriptSuffix)
+
+	//交易单固定部分：Version + Hash + Timestamp + LockTime + ExpiredTime + InputCount + OutputCount
+	txBaseSize = 4 + txHashLength + 8 + 8 + 8 + 4 + 4
+	//签名后每个输入：OutputTransactionHash + OutputIndex + Size + UnlockScript
+	txSignedInputSize = txHashLength + 4 + 4 + unlockScriptLength
+	//每个输出：Index + Amount + Size + LockScript
+	txOutputSize = 4 + 8 + 4 + lockScriptLength
+)
+
+//TransactionMsg FIII交易单，参考 FiiiChain.Messages/TransactionMsg.cs
+/*
+	序列化格式，整数均为大端字节序：
+
+	Version(4) | Timestamp(8) | LockTime(8) | ExpiredTime(8) |
+	InputCount(4) | Inputs... | OutputCount(4) | Outputs...
+
+	交易单哈希 = SHA256(Version之后的全部数据)
+*/
+type TransactionMsg struct {
+	Version     int32        `json:"Version"`
+	Hash        string       `json:"Hash"`
+	Timestamp   int64        `json:"Timestamp"`
+	LockTime    int64        `json:"Locktime"`
+	ExpiredTime int64        `json:"ExpiredTime"`
+	InputCount  int32        `json:"InputCount"`
+	OutputCount int32        `json:"OutputCount"`
+	Inputs      []*InputMsg  `json:"Inputs"`
+	Outputs     []*OutputMsg `json:"Outputs"`
+	Size        int32        `json:"Size"`
+}
+
+//InputMsg 交易单输入
+/*
+	OutputTransactionHash(32) | OutputIndex(4) | Size(4) | UnlockScript(Size)
+*/
+type InputMsg struct {
+	OutputTransactionHash string `json:"OutputTransactionHash"`
+	OutputIndex           int32  `json:"OutputIndex"`
+	Size                  int32  `json:"Size"`
+	UnlockScript          string `json:"UnlockScript"`
+}
+
+//OutputMsg 交易单输出
+/*
+	Index(4) | Amount(8) | Size(4) | LockScript(Size)
+*/
+type OutputMsg struct {
+	Index      int32  `json:"Index"`
+	Amount     int64  `json:"Amount"`
+	Size       int32  `json:"Size"`
+	LockScript string `json:"LockScript"`
+}
+
+//NewTransactionMsg 创建空交易单
+func NewTransactionMsg(version int32, lockTime, expiredTime int64) *TransactionMsg {
+	tx := &TransactionMsg{
+		Version:     version,
+		Timestamp:   time.Now().UnixNano() / int64(time.Millisecond),
+		LockTime:    lockTime,
+		ExpiredTime: expiredTime,
+		Inputs:      make([]*InputMsg, 0),
+		Outputs:     make([]*OutputMsg, 0),
+	}
+	return tx
+}
+
+//AddInput 添加输入
+func (tx *TransactionMsg) AddInput(txid string, vout uint64) error {
+	hash, err := hex.DecodeString(txid)
+	if err != nil || len(hash) != txHashLength {
+		return fmt.Errorf("invalid utxo txid: %s", txid)
+	}
+
+	tx.Inputs = append(tx.Inputs, &InputMsg{
+		OutputTransactionHash: strings.ToUpper(txid),
+		OutputIndex:           int32(vout),
+	})
+	tx.InputCount = int32(len(tx.Inputs))
+	return nil
+}
+
+//AddOutput 添加输出，amount为最小单位的数量
+func (tx *TransactionMsg) AddOutput(address string, amount int64, isTestNet bool) error {
+
+	if amount <= 0 {
+		return fmt.Errorf("invalid amount: %d to send to %s", amount, address)
+	}
+
+	lockScript, err := NewLockScript(address, isTestNet)
+	if err != nil {
+		return err
+	}
+
+	tx.Outputs = append(tx.Outputs, &OutputMsg{
+		Index:      int32(len(tx.Outputs)),
+		Amount:     amount,
+		Size:       int32(len(lockScript)),
+		LockScript: lockScript,
+	})
+	tx.OutputCount = int32(len(tx.Outputs))
+	return nil
+}
+
+//SignMessage 第i个输入的待签消息，OutputTransactionHash + OutputIndex
+func (tx *TransactionMsg) SignMessage(i int) (string, error) {
+	if i < 0 || i >= len(tx.Inputs) {
+		return "", fmt.Errorf("input index: %d out of range", i)
+	}
+	return tx.Inputs[i].SignMessage(), nil
+}
+
+//SetUnlockScript 使用签名和公钥填充第i个输入的解锁脚本
+func (tx *TransactionMsg) SetUnlockScript(i int, signature, pubkey []byte) error {
+	if i < 0 || i >= len(tx.Inputs) {
+		return fmt.Errorf("input index: %d out of range", i)
+	}
+
+	unlockScript, err := NewUnlockScript(signature, pubkey)
+	if err != nil {
+		return err
+	}
+
+	tx.Inputs[i].UnlockScript = unlockScript
+	tx.Inputs[i].Size = int32(len(unlockScript))
+	return nil
+}
+
+//IsSigned 是否所有输入都已填充解锁脚本
+func (tx *TransactionMsg) IsSigned() bool {
+	if len(tx.Inputs) == 0 {
+		return false
+	}
+	for _, in := range tx.Inputs {
+		if len(in.UnlockScript) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//Complete 计算交易单哈希和大小
+func (tx *TransactionMsg) Complete() {
+	body := tx.serializeBody()
+	hash := sha256.Sum256(body)
+	tx.Hash = strings.ToUpper(hex.EncodeToString(hash[:]))
+	tx.Size = int32(len(body) + 4 + txHashLength)
+}
+
+//EstimateSignedSize 签名后的交易单大小，未签名的输入按解锁脚本的固定长度计算
+func (tx *TransactionMsg) EstimateSignedSize() int {
+	size := len(tx.serializeBody()) + 4 + txHashLength
+	for _, in := range tx.Inputs {
+		if len(in.UnlockScript) == 0 {
+			size = size + unlockScriptLength
+		}
+	}
+	return size
+}
+
+//EstimateTxSize 根据输入输出数量计算签名后的交易单大小
+func EstimateTxSize(inputs, outputs int) int {
+	return txBaseSize + inputs*txSignedInputSize + outputs*txOutputSize
+}
+
+//Serialize 序列化交易单
+func (tx *TransactionMsg) Serialize() []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(tx.Version))
+	return append(data, tx.serializeBody()...)
+}
+
+//SerializeToHex 序列化交易单为hex
+func (tx *TransactionMsg) SerializeToHex() string {
+	return hex.EncodeToString(tx.Serialize())
+}
+
+//serializeBody 序列化Version以外的数据，用于计算交易单哈希
+func (tx *TransactionMsg) serializeBody() []byte {
+	data := make([]byte, 0)
+	data = appendUint64(data, uint64(tx.Timestamp))
+	data = appendUint64(data, uint64(tx.LockTime))
+	data = appendUint64(data, uint64(tx.ExpiredTime))
+	data = appendUint32(data, uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		data = append(data, in.Serialize()...)
+	}
+	data = appendUint32(data, uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		data = append(data, out.Serialize()...)
+	}
+	return data
+}
+
+//SignMessage 待签消息
+func (in *InputMsg) SignMessage() string {
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(in.OutputIndex))
+	return in.OutputTransactionHash + strings.ToUpper(hex.EncodeToString(index))
+}
+
+//Serialize 序列化输入
+func (in *InputMsg) Serialize() []byte {
+	data, _ := hex.DecodeString(in.OutputTransactionHash)
+	data = appendUint32(data, uint32(in.OutputIndex))
+	data = appendUint32(data, uint32(len(in.UnlockScript)))
+	return append(data, []byte(in.UnlockScript)...)
+}
+
+//Serialize 序列化输出
+func (out *OutputMsg) Serialize() []byte {
+	data := make([]byte, 0)
+	data = appendUint32(data, uint32(out.Index))
+	data = appendUint64(data, uint64(out.Amount))
+	data = appendUint32(data, uint32(len(out.LockScript)))
+	return append(data, []byte(out.LockScript)...)
+}
+
+//DecodeTransactionMsg 解析hex编码的交易单
+func DecodeTransactionMsg(rawHex string) (*TransactionMsg, error) {
+	data, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("transaction hex is invalid: %v", err)
+	}
+	return DeserializeTransactionMsg(data)
+}
+
+//DeserializeTransactionMsg 反序列化交易单
+func DeserializeTransactionMsg(data []byte) (*TransactionMsg, error) {
+
+	var (
+		err error
+		r   = &txMsgReader{data: data}
+		tx  = &TransactionMsg{}
+	)
+
+	version, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	tx.Version = int32(version)
+
+	timestamp, err := r.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	tx.Timestamp = int64(timestamp)
+
+	lockTime, err := r.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	tx.LockTime = int64(lockTime)
+
+	expiredTime, err := r.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	tx.ExpiredTime = int64(expiredTime)
+
+	inputCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	tx.Inputs = make([]*InputMsg, 0)
+	for i := uint32(0); i < inputCount; i++ {
+		in := &InputMsg{}
+		hash, err := r.readBytes(txHashLength)
+		if err != nil {
+			return nil, err
+		}
+		in.OutputTransactionHash = strings.ToUpper(hex.EncodeToString(hash))
+		index, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		in.OutputIndex = int32(index)
+		script, err := r.readScript()
+		if err != nil {
+			return nil, err
+		}
+		in.UnlockScript = script
+		in.Size = int32(len(script))
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	tx.InputCount = int32(len(tx.Inputs))
+
+	outputCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	tx.Outputs = make([]*OutputMsg, 0)
+	for i := uint32(0); i < outputCount; i++ {
+		out := &OutputMsg{}
+		index, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+		out.Index = int32(index)
+		amount, err := r.readUint64()
+		if err != nil {
+			return nil, err
+		}
+		out.Amount = int64(amount)
+		script, err := r.readScript()
+		if err != nil {
+			return nil, err
+		}
+		out.LockScript = script
+		out.Size = int32(len(script))
+		tx.Outputs = append(tx.Outputs, out)
+	}
+	tx.OutputCount = int32(len(tx.Outputs))
+
+	if r.remain() > 0 {
+		return nil, fmt.Errorf("transaction data has %d unexpected trailing bytes", r.remain())
+	}
+
+	tx.Complete()
+
+	return tx, nil
+}
+
+//NewLockScript 地址转锁定脚本
+func NewLockScript(address string, isTestNet bool) (string, error) {
+	cfg := fiiicoin_addrdec.FIII_mainnetAddressP2PKH
+	if isTestNet {
+		cfg = fiiicoin_addrdec.FIII_testnetAddressP2PKH
+	}
+
+	hash, err := fiiicoin_addrdec.Default.AddressDecode(address, cfg)
+	if err != nil || len(hash) != cfg.HashLen {
+		return "", fmt.Errorf("invalid address: %s", address)
+	}
+
+	return lockScriptPrefix + strings.ToUpper(hex.EncodeToString(hash)) + lockScriptSuffix, nil
+}
+
+//NewUnlockScript 签名和公钥转解锁脚本
+func NewUnlockScript(signature, pubkey []byte) (string, error) {
+	if len(signature) != signatureLength {
+		return "", fmt.Errorf("invalid signature length: %d", len(signature))
+	}
+	if len(pubkey) != pubKeyLength {
+		return "", fmt.Errorf("invalid public key length: %d", len(pubkey))
+	}
+
+	return strings.ToUpper(hex.EncodeToString(signature)) + unlockScriptSigHashAll + " " +
+		unlockScriptPubKeyPrefix + strings.ToUpper(hex.EncodeToString(pubkey)), nil
+}
+
+func appendUint32(data []byte, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return append(data, b...)
+}
+
+func appendUint64(data []byte, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return append(data, b...)
+}
+
+//txMsgReader 交易单数据读取器
+type txMsgReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *txMsgReader) remain() int {
+	return len(r.data) - r.offset
+}
+
+func (r *txMsgReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || r.remain() < n {
+		return nil, fmt.Errorf("transaction data is too short at offset: %d", r.offset)
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b, nil
+}
+
+func (r *txMsgReader) readUint32() (uint32, error) {
+	b, err := r.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (r *txMsgReader) readUint64() (uint64, error) {
+	b, err := r.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (r *txMsgReader) readScript() (string, error) {
+	size, err := r.readUint32()
+	if err != nil {
+		return "", err
+	}
+	if int(size) > r.remain() {
+		return "", fmt.Errorf("script size: %d exceeds transaction data at offset: %d", size, r.offset)
+	}
+	b, err := r.readBytes(int(size))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
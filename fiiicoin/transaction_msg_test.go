@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+//testChainTransactionMsg 复现链上交易 CE427FC1CF51EF1C72BAF0C97D7547A47D8E564EA662F36AA57D09F958164CED
+func testChainTransactionMsg(t *testing.T) *TransactionMsg {
+	tx := NewTransactionMsg(1, 0, 0)
+	tx.Timestamp = 1546443912218
+
+	err := tx.AddInput("5E36D1C2879780E8ABBE4B451DE9202F66D1F037BF3D4372BA463522459B4BD4", 1)
+	if err != nil {
+		t.Fatalf("AddInput failed unexpected error: %v\n", err)
+	}
+	err = tx.AddOutput("fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg", 624000000000, false)
+	if err != nil {
+		t.Fatalf("AddOutput failed unexpected error: %v\n", err)
+	}
+	err = tx.AddOutput("fiiimRS3TUtbAyTX3SYLxZ7rq5wB2bcT5Y2KFb", 510934733923614, false)
+	if err != nil {
+		t.Fatalf("AddOutput failed unexpected error: %v\n", err)
+	}
+	return tx
+}
+
+func TestTransactionMsg_Hash(t *testing.T) {
+	tx := testChainTransactionMsg(t)
+
+	msg, _ := tx.SignMessage(0)
+	t.Logf("message: %s", msg)
+	if msg != "5E36D1C2879780E8ABBE4B451DE9202F66D1F037BF3D4372BA463522459B4BD400000001" {
+		t.Errorf("unexpected sign message: %s", msg)
+	}
+
+	signature, _ := hex.DecodeString("CF1B46157EB1BA6E39CDA6F4E64217CC34F6E0AEFE9107AAFF98474BA671BCB48C7A7DE674609CA6C9EF1C142A3F666018FEFAB3EB78B21C2EC03BABD931B50D")
+	pubkey, _ := hex.DecodeString("223588FBFAF10408F042469031DD6D0628CC9EDE9F312AD128A431F420492242")
+	err := tx.SetUnlockScript(0, signature, pubkey)
+	if err != nil {
+		t.Fatalf("SetUnlockScript failed unexpected error: %v\n", err)
+	}
+
+	tx.Complete()
+	t.Logf("hash: %s", tx.Hash)
+	t.Logf("size: %d", tx.Size)
+	if tx.Hash != "CE427FC1CF51EF1C72BAF0C97D7547A47D8E564EA662F36AA57D09F958164CED" {
+		t.Errorf("unexpected transaction hash: %s", tx.Hash)
+	}
+}
+
+func TestTransactionMsg_EstimateSignedSize(t *testing.T) {
+	tx := testChainTransactionMsg(t)
+	estimated := tx.EstimateSignedSize()
+
+	signature, _ := hex.DecodeString("CF1B46157EB1BA6E39CDA6F4E64217CC34F6E0AEFE9107AAFF98474BA671BCB48C7A7DE674609CA6C9EF1C142A3F666018FEFAB3EB78B21C2EC03BABD931B50D")
+	pubkey, _ := hex.DecodeString("223588FBFAF10408F042469031DD6D0628CC9EDE9F312AD128A431F420492242")
+	tx.SetUnlockScript(0, signature, pubkey)
+	tx.Complete()
+
+	t.Logf("estimated size: %d, signed size: %d", estimated, tx.Size)
+	if estimated != int(tx.Size) {
+		t.Errorf("estimated size: %d is not equal to signed size: %d", estimated, tx.Size)
+	}
+	if EstimateTxSize(1, 2) != int(tx.Size) {
+		t.Errorf("EstimateTxSize: %d is not equal to signed size: %d", EstimateTxSize(1, 2), tx.Size)
+	}
+
+	//多个输入输出时，估算大小也要等于签名后的大小，否则按估算选币的手续费不足
+	for _, c := range []struct{ inputs, outputs int }{{2, 1}, {3, 2}, {10, 5}} {
+		tx := NewTransactionMsg(1, 0, 0)
+		for i := 0; i < c.inputs; i++ {
+			tx.AddInput("5E36D1C2879780E8ABBE4B451DE9202F66D1F037BF3D4372BA463522459B4BD4", uint64(i))
+		}
+		for i := 0; i < c.outputs; i++ {
+			tx.AddOutput("fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg", int64(i+1), false)
+		}
+		estimated := tx.EstimateSignedSize()
+		for i := 0; i < c.inputs; i++ {
+			tx.SetUnlockScript(i, signature, pubkey)
+		}
+		tx.Complete()
+
+		if estimated != int(tx.Size) || EstimateTxSize(c.inputs, c.outputs) != int(tx.Size) {
+			t.Errorf("inputs: %d, outputs: %d, estimated size: %d is not equal to signed size: %d", c.inputs, c.outputs, estimated, tx.Size)
+		}
+	}
+}
+
+func TestDecodeTransactionMsg(t *testing.T) {
+	tx := testChainTransactionMsg(t)
+	tx.Complete()
+
+	rawHex := tx.SerializeToHex()
+	t.Logf("rawHex: %s", rawHex)
+
+	decoded, err := DecodeTransactionMsg(rawHex)
+	if err != nil {
+		t.Fatalf("DecodeTransactionMsg failed unexpected error: %v\n", err)
+	}
+
+	if decoded.Hash != tx.Hash {
+		t.Errorf("decoded hash: %s, expected: %s", decoded.Hash, tx.Hash)
+	}
+	if decoded.SerializeToHex() != rawHex {
+		t.Errorf("decoded transaction is not equal to origin")
+	}
+	if decoded.IsSigned() {
+		t.Errorf("empty transaction should not be signed")
+	}
+
+	_, err = DecodeTransactionMsg(rawHex[:len(rawHex)-2])
+	if err == nil {
+		t.Errorf("truncated transaction should be rejected")
+	}
+}
+
+func TestVerifyInputSignature(t *testing.T) {
+	tx := testChainTransactionMsg(t)
+
+	signature, _ := hex.DecodeString("CF1B46157EB1BA6E39CDA6F4E64217CC34F6E0AEFE9107AAFF98474BA671BCB48C7A7DE674609CA6C9EF1C142A3F666018FEFAB3EB78B21C2EC03BABD931B50D")
+	pubkey, _ := hex.DecodeString("223588FBFAF10408F042469031DD6D0628CC9EDE9F312AD128A431F420492242")
+	if !verifyInputSignature(tx.Inputs[0], signature, pubkey) {
+		t.Errorf("signature of chain transaction should be valid")
+	}
+
+	signature[0] ^= 0xFF
+	if verifyInputSignature(tx.Inputs[0], signature, pubkey) {
+		t.Errorf("tampered signature should be invalid")
+	}
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+const (
+	BumpModeReplace = "replace" //使用相同的输入重新构建交易单，从找零中扣除更高的手续费
+	BumpModeChild   = "child"   //花费原交易单的找零构建子交易单，由子交易单补足整体手续费
+)
+
+//bumpTxPlan 加速交易单的计划
+type bumpTxPlan struct {
+	unspents []*Unspent
+	outputs  map[string]decimal.Decimal //包括找零
+	to       map[string]decimal.Decimal //不包括找零
+	fees     decimal.Decimal
+}
+
+//BumpFeeRawTransaction 为已广播但仍在交易池中的交易单构建加速交易单。
+//origin为之前提交的交易单，需要有TxID，或已签名的RawHex。
+//返回的交易单与CreateRawTransaction的结果一样，需要签名、验证后再提交。
+func (decoder *TransactionDecoder) BumpFeeRawTransaction(wrapper openwallet.WalletDAI, origin *openwallet.RawTransaction, feeRate, mode string) (*openwallet.RawTransaction, error) {
+
+	if origin == nil || origin.Account == nil {
+		return nil, fmt.Errorf("origin transaction account is empty")
+	}
+
+	txid := origin.TxID
+	if len(txid) == 0 && len(origin.RawHex) > 0 {
+		txMsg, err := DecodeTransactionMsg(origin.RawHex)
+		if err != nil {
+			return nil, err
+		}
+		if !txMsg.IsSigned() {
+			return nil, fmt.Errorf("origin transaction is not signed")
+		}
+		txid = txMsg.Hash
+	}
+
+	return decoder.BumpFeeRawTransactionByTxID(wrapper, origin.Account, origin.Coin, txid, feeRate, mode)
+}
+
+//BumpFeeRawTransactionByTxID 根据交易单ID构建加速交易单，交易单必须仍在交易池中。
+//mode为replace时重新花费原交易单的输入，为child时花费原交易单的找零。
+func (decoder *TransactionDecoder) BumpFeeRawTransactionByTxID(wrapper openwallet.WalletDAI, account *openwallet.AssetsAccount, coin openwallet.Coin, txid, feeRate, mode string) (*openwallet.RawTransaction, error) {
+
+	var (
+		plan *bumpTxPlan
+	)
+
+	if len(txid) == 0 {
+		return nil, fmt.Errorf("bump transaction txid is empty")
+	}
+
+	if coin.IsContract {
+		return nil, fmt.Errorf("do not support token transaction")
+	}
+
+	if isMultiSigAccount(account) {
+		return nil, errMultiSigNotSupported()
+	}
+
+	if len(mode) == 0 {
+		mode = BumpModeReplace
+	}
+	if mode != BumpModeReplace && mode != BumpModeChild {
+		return nil, fmt.Errorf("unknown bump mode: %s", mode)
+	}
+
+	//只能加速交易池中的交易单
+	inMemPool, err := decoder.isTxInMemPool(txid)
+	if err != nil {
+		return nil, err
+	}
+	if !inMemPool {
+		return nil, fmt.Errorf("transaction: %s is not in mempool", txid)
+	}
+
+	trx, err := decoder.wm.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	if len(trx.Vins) == 0 || len(trx.Vouts) == 0 {
+		return nil, fmt.Errorf("transaction: %s can not be bumped", txid)
+	}
+
+	feesRate, err := decoder.getFeeRate(feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	//属于账户的输出视为找零
+	isChange := func(address string) bool {
+		addresses, findErr := wrapper.GetAddressList(0, -1, "AccountID", account.AccountID, "Address", address)
+		return findErr == nil && len(addresses) > 0
+	}
+
+	if mode == BumpModeChild {
+		plan, err = decoder.planChildTransaction(trx, isChange, feesRate)
+	} else {
+		plan, err = decoder.planReplaceTransaction(trx, isChange, feesRate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raxTxTo := make(map[string]string, 0)
+	for a, m := range plan.to {
+		raxTxTo[a] = m.StringFixed(decoder.wm.Decimal())
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Coin:     coin,
+		Account:  account,
+		FeeRate:  feesRate.StringFixed(decoder.wm.Decimal()),
+		To:       raxTxTo,
+		Fees:     plan.fees.StringFixed(decoder.wm.Decimal()),
+		Required: 1,
+	}
+
+	//替换的交易单沿用原交易单的锁定时间和过期时间
+	if mode == BumpModeReplace {
+		if trx.LockTime > 0 {
+			rawTx.SetExtParam("lockTime", trx.LockTime)
+		}
+		if trx.ExpiredTime > 0 {
+			rawTx.SetExtParam("expiredTime", trx.ExpiredTime)
+		}
+	}
+
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	decoder.wm.Log.Std.Notice("Bump Transaction: %s", txid)
+	decoder.wm.Log.Std.Notice("Bump Mode: %s", mode)
+	decoder.wm.Log.Std.Notice("Fee Rate: %s", rawTx.FeeRate)
+	decoder.wm.Log.Std.Notice("Fees: %s", rawTx.Fees)
+	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+	err = decoder.createFIIIRawTransaction(wrapper, rawTx, plan.unspents, plan.outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return rawTx, nil
+}
+
+//planReplaceTransaction 使用原交易单相同的输入，接收地址和数量不变，从找零中扣除增加的手续费
+func (decoder *TransactionDecoder) planReplaceTransaction(trx *Transaction, isChange func(address string) bool, feesRate decimal.Decimal) (*bumpTxPlan, error) {
+
+	var (
+		totalInput    = decimal.Zero
+		totalOutput   = decimal.Zero
+		changeAddress = ""
+		changeAmount  = decimal.Zero
+		plan          = &bumpTxPlan{
+			unspents: make([]*Unspent, 0),
+			outputs:  make(map[string]decimal.Decimal),
+			to:       make(map[string]decimal.Decimal),
+		}
+	)
+
+	for _, vin := range trx.Vins {
+		plan.unspents = append(plan.unspents, &Unspent{
+			TxID:      vin.TxID,
+			Vout:      vin.Vout,
+			Address:   vin.Addr,
+			Amount:    vin.Amount,
+			Spendable: true,
+		})
+		totalInput = totalInput.Add(common.IntToDecimals(int64(vin.Amount), decoder.wm.Decimal()))
+	}
+
+	for _, vout := range trx.Vouts {
+		amount := common.IntToDecimals(int64(vout.Amount), decoder.wm.Decimal())
+		totalOutput = totalOutput.Add(amount)
+		//第一个属于账户的输出作为找零，由它支付增加的手续费
+		if len(changeAddress) == 0 && isChange(vout.Addr) {
+			changeAddress = vout.Addr
+			changeAmount = amount
+			continue
+		}
+		plan.outputs = appendOutput(plan.outputs, vout.Addr, amount)
+		plan.to = appendOutput(plan.to, vout.Addr, amount)
+	}
+
+	if len(changeAddress) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "transaction: %s has no change output to pay more fees, try child mode", trx.TxID)
+	}
+
+	oldFees := totalInput.Sub(totalOutput)
+	fees, err := decoder.wm.EstimateFee(int64(len(trx.Vins)), int64(len(trx.Vouts)), feesRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if fees.LessThanOrEqual(oldFees) {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the fees: %s of new fee rate is not greater than the original fees: %s", fees.String(), oldFees.String())
+	}
+
+	changeAmount = changeAmount.Sub(fees.Sub(oldFees))
+	if changeAmount.LessThan(decimal.Zero) {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the change of transaction: %s is not enough to pay more fees: %s", trx.TxID, fees.Sub(oldFees).String())
+	}
+
+	//找零低于粉尘限制，直接作为手续费
+	if changeAmount.LessThan(decoder.wm.Config.DustLimit) {
+		fees = fees.Add(changeAmount)
+	} else {
+		plan.outputs = appendOutput(plan.outputs, changeAddress, changeAmount)
+	}
+	plan.fees = fees
+
+	return plan, nil
+}
+
+//planChildTransaction 花费原交易单属于账户的输出，子交易单支付的手续费使两笔交易单整体达到新的费率
+func (decoder *TransactionDecoder) planChildTransaction(trx *Transaction, isChange func(address string) bool, feesRate decimal.Decimal) (*bumpTxPlan, error) {
+
+	var (
+		totalInput    = decimal.Zero
+		totalOutput   = decimal.Zero
+		balance       = decimal.Zero
+		changeAddress = ""
+		plan          = &bumpTxPlan{
+			unspents: make([]*Unspent, 0),
+			outputs:  make(map[string]decimal.Decimal),
+			to:       make(map[string]decimal.Decimal),
+		}
+	)
+
+	for _, vin := range trx.Vins {
+		totalInput = totalInput.Add(common.IntToDecimals(int64(vin.Amount), decoder.wm.Decimal()))
+	}
+
+	for _, vout := range trx.Vouts {
+		amount := common.IntToDecimals(int64(vout.Amount), decoder.wm.Decimal())
+		totalOutput = totalOutput.Add(amount)
+		if !isChange(vout.Addr) || len(plan.unspents) >= decoder.wm.Config.MaxTxInputs {
+			continue
+		}
+		if len(changeAddress) == 0 {
+			changeAddress = vout.Addr
+		}
+		plan.unspents = append(plan.unspents, &Unspent{
+			TxID:      trx.TxID,
+			Vout:      vout.Vout,
+			Address:   vout.Addr,
+			Amount:    vout.Amount,
+			Spendable: true,
+		})
+		balance = balance.Add(amount)
+	}
+
+	if len(plan.unspents) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "transaction: %s has no output of account to spend", trx.TxID)
+	}
+
+	//整体手续费 = (原交易单大小 + 子交易单大小) * 新费率
+	parentFees := totalInput.Sub(totalOutput)
+	parentSize := EstimateTxSize(len(trx.Vins), len(trx.Vouts))
+	childSize := EstimateTxSize(len(plan.unspents), 1)
+	packageFees := decoder.wm.CalculateFee(parentSize+childSize, feesRate)
+
+	fees := packageFees.Sub(parentFees)
+	childFees := decoder.wm.CalculateFee(childSize, feesRate)
+	if fees.LessThan(childFees) {
+		fees = childFees
+	}
+
+	amount := balance.Sub(fees)
+	if amount.LessThan(decoder.wm.Config.DustLimit) {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the outputs: %s of transaction: %s is not enough to pay fees: %s", balance.String(), trx.TxID, fees.String())
+	}
+
+	plan.outputs = appendOutput(plan.outputs, changeAddress, amount)
+	plan.to = appendOutput(plan.to, changeAddress, amount)
+	plan.fees = fees
+
+	return plan, nil
+}
+
+//isTxInMemPool 交易单是否在交易池中
+func (decoder *TransactionDecoder) isTxInMemPool(txid string) (bool, error) {
+	txids, err := decoder.wm.GetTxIDsInMemPool()
+	if err != nil {
+		return false, err
+	}
+	for _, id := range txids {
+		if strings.EqualFold(id, txid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+//testStuckTransaction 1个输入1FIII，支付0.5到receiver，找零到change，手续费0.0001
+func testStuckTransaction() *Transaction {
+	return &Transaction{
+		TxID: "CE427FC1CF51EF1C72BAF0C97D7547A47D8E564EA662F36AA57D09F958164CED",
+		Vins: []*Vin{
+			{TxID: "5E36D1C2879780E8ABBE4B451DE9202F66D1F037BF3D4372BA463522459B4BD4", Vout: 1, Addr: "change", Amount: 100000000},
+		},
+		Vouts: []*Vout{
+			{Vout: 0, Addr: "receiver", Amount: 50000000},
+			{Vout: 1, Addr: "change", Amount: 49990000},
+		},
+	}
+}
+
+func testIsChange(address string) bool {
+	return address == "change"
+}
+
+func TestPlanReplaceTransaction(t *testing.T) {
+	decoder := testSplitDecoder(50)
+	feesRate, _ := decimal.NewFromString("0.01")
+
+	plan, err := decoder.planReplaceTransaction(testStuckTransaction(), testIsChange, feesRate)
+	if err != nil {
+		t.Fatalf("planReplaceTransaction failed unexpected error: %v\n", err)
+	}
+
+	if !plan.to["receiver"].Equal(decimal.New(5, -1)) {
+		t.Errorf("receiver amount: %s should not be changed", plan.to["receiver"])
+	}
+	if _, ok := plan.to["change"]; ok {
+		t.Errorf("change should not be in receivers")
+	}
+	if !plan.outputs["receiver"].Add(plan.outputs["change"]).Add(plan.fees).Equal(decimal.New(1, 0)) {
+		t.Errorf("outputs: %v + fees: %s is not equal to inputs", plan.outputs, plan.fees)
+	}
+	t.Logf("fees: %s, change: %s", plan.fees, plan.outputs["change"])
+
+	//费率不高于原交易单
+	feesRate, _ = decimal.NewFromString("0.0001")
+	_, err = decoder.planReplaceTransaction(testStuckTransaction(), testIsChange, feesRate)
+	if err == nil {
+		t.Errorf("replace transaction should be failed when fees is not greater")
+	}
+}
+
+func TestPlanChildTransaction(t *testing.T) {
+	decoder := testSplitDecoder(50)
+	feesRate, _ := decimal.NewFromString("0.01")
+
+	plan, err := decoder.planChildTransaction(testStuckTransaction(), testIsChange, feesRate)
+	if err != nil {
+		t.Fatalf("planChildTransaction failed unexpected error: %v\n", err)
+	}
+
+	if len(plan.unspents) != 1 || plan.unspents[0].Vout != 1 {
+		t.Errorf("child transaction should spend the change output")
+	}
+
+	parentSize := EstimateTxSize(1, 2)
+	childSize := EstimateTxSize(1, 1)
+	packageFees := decoder.wm.CalculateFee(parentSize+childSize, feesRate)
+	if !plan.fees.Add(decimal.New(1, -4)).Equal(packageFees) {
+		t.Errorf("child fees: %s + parent fees: 0.0001 is not equal to package fees: %s", plan.fees, packageFees)
+	}
+	t.Logf("fees: %s, outputs: %v", plan.fees, plan.outputs)
+}
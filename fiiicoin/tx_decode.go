@@ -16,13 +16,11 @@
 package fiiicoin
 
 import (
-	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/blocktree/fiiicoin-adapter/fiiicoin_addrdec"
 	"github.com/blocktree/go-owcdrivers/fiiiTransaction"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
@@ -114,23 +112,31 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		return nil, fmt.Errorf("transaction is not completed validation")
 	}
 
-	rawHex, err := base64.StdEncoding.DecodeString(rawTx.RawHex)
+	txMsg, err := DecodeTransactionMsg(rawTx.RawHex)
 	if err != nil {
 		return nil, openwallet.ConvertError(err)
 	}
 
-	var txSend map[string]interface{}
-	err = json.Unmarshal(rawHex, &txSend)
+	if !txMsg.IsSigned() {
+		return nil, fmt.Errorf("transaction is not signed")
+	}
+
+	//节点未同步完成时广播的交易单可能被丢弃
+	err = decoder.wm.checkNodeReadyIfEnabled()
 	if err != nil {
-		return nil, openwallet.ConvertError(err)
+		return nil, ConvertRPCError(err, openwallet.ErrSubmitRawTransactionFailed)
 	}
 
-	err = decoder.wm.BroadcastTransaction(txSend)
+	err = decoder.wm.BroadcastTransaction(txMsg)
 	if err != nil {
-		return nil, err
+		//交易单已在链上视为广播成功
+		if !IsRPCErrorCode(err, RPCErrVerifyAlreadyInChain) {
+			return nil, ConvertRPCError(err, openwallet.ErrSubmitRawTransactionFailed)
+		}
+		decoder.wm.Log.Warningf("transaction: %s is already in chain", txMsg.Hash)
 	}
 
-	rawTx.TxID = txSend["Hash"].(string)
+	rawTx.TxID = txMsg.Hash
 	rawTx.IsSubmit = true
 
 	decimals := int32(0)
@@ -166,7 +172,24 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateFIIIRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
+	//手续费按单签解锁脚本估算，多重签名账户在选币前拒绝
+	if isMultiSigAccount(rawTx.Account) {
+		return errMultiSigNotSupported()
+	}
+
+	unspents, err := decoder.getAccountUnspents(wrapper, rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+
+	return decoder.buildFIIIRawTransaction(wrapper, rawTx, unspents)
+}
+
+//buildFIIIRawTransaction 使用账户的utxo构建交易单
+func (decoder *TransactionDecoder) buildFIIIRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, unspents []*Unspent) error {
+
 	var (
+		err          error
 		usedUTXO     []*Unspent
 		outputAddrs  = make(map[string]decimal.Decimal)
 		balance      = decimal.New(0, 0)
@@ -176,41 +199,16 @@ func (decoder *TransactionDecoder) CreateFIIIRawTransaction(wrapper openwallet.W
 		accountID    = rawTx.Account.AccountID
 		destinations = make([]string, 0)
 		//accountTotalSent = decimal.Zero
-		limit = 2000
 	)
 
-	address, err := wrapper.GetAddressList(0, limit, "AccountID", rawTx.Account.AccountID)
+	//检查接收地址和数量
+	receivers, err := decoder.ValidateReceivers(rawTx.To)
 	if err != nil {
 		return err
 	}
 
-	if len(address) == 0 {
-		//return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
-		return fmt.Errorf("[%s] have not addresses", accountID)
-	}
-
-	searchAddrs := make([]string, 0)
-	for _, address := range address {
-		searchAddrs = append(searchAddrs, address.Address)
-	}
-	//decoder.wm.Log.Debug(searchAddrs)
-	//查找账户的utxo，强制6个确认
-	unspents, err := decoder.wm.ListUnspent(6, searchAddrs...)
-	if err != nil {
-		return err
-	}
-
-	if len(unspents) == 0 {
-		return fmt.Errorf("[%s] balance of more 6 confirmations is not enough", accountID)
-	}
-
-	if len(rawTx.To) == 0 {
-		return errors.New("Receiver addresses is empty!")
-	}
-
 	//计算总发送金额
-	for addr, amount := range rawTx.To {
-		deamount, _ := decimal.NewFromString(amount)
+	for addr, deamount := range receivers {
 		totalSend = totalSend.Add(deamount)
 		destinations = append(destinations, addr)
 		//计算账户的实际转账amount
@@ -221,79 +219,104 @@ func (decoder *TransactionDecoder) CreateFIIIRawTransaction(wrapper openwallet.W
 		//}
 	}
 
-	//获取utxo，按小到大排序
-	sort.Sort(UnspentSort{unspents, func(a, b *Unspent) int {
-		if a.Amount > b.Amount {
-			return 1
-		} else {
-			return -1
-		}
-	}})
+	feesRate, err = decoder.getFeeRate(rawTx.FeeRate)
+	if err != nil {
+		return err
+	}
 
-	if len(rawTx.FeeRate) == 0 {
-		feesRate, err = decoder.wm.EstimateFeeRate()
-		if err != nil {
-			return err
-		}
-	} else {
-		feesRate, _ = decimal.NewFromString(rawTx.FeeRate)
+	//选择utxo的策略，交易单扩展参数优先于配置
+	selector, err := decoder.coinSelector(rawTx, decoder.wm.Config.MaxTxInputs)
+	if err != nil {
+		return err
 	}
 
 	decoder.wm.Log.Info("Calculating wallet unspent record to build transaction...")
 	computeTotalSend := totalSend
-	//循环的计算余额是否足够支付发送数额+手续费
-	for {
-
-		usedUTXO = make([]*Unspent, 0)
-		balance = decimal.New(0, 0)
 
-		//计算一个可用于支付的余额
-		for _, u := range unspents {
+	//装配输出
+	for to, decamount := range receivers {
+		outputAddrs = appendOutput(outputAddrs, to, decamount)
+	}
 
-			if u.Spendable {
-				ua := common.IntToDecimals(int64(u.Amount), decoder.wm.Decimal())
-				balance = balance.Add(ua)
-				usedUTXO = append(usedUTXO, u)
-				if balance.GreaterThanOrEqual(computeTotalSend) {
-					break
-				}
-			}
+	//计算手续费，有找零时增加一个找零输出，feesShortfall为签名后大小所需手续费超出预估的部分
+	feesShortfall := decimal.Zero
+	estimateFee := func(inputs int, withChange bool) (decimal.Decimal, error) {
+		outputs := len(destinations)
+		if withChange {
+			outputs = outputs + 1
 		}
+		fees, err := decoder.wm.EstimateFee(int64(inputs), int64(outputs), feesRate)
+		return fees.Add(feesShortfall), err
+	}
 
-		if balance.LessThan(computeTotalSend) {
-			return fmt.Errorf("The balance: %s is not enough! ", balance.StringFixed(decoder.wm.Decimal()))
-		}
+	//签名后大小所需的手续费超出预估时，补足差额重新选择utxo的最多次数
+	const maxFeesReselect = 3
+
+	var changeAddress string
+	for tries := 0; ; tries++ {
 
-		//计算手续费，找零地址有2个，一个是发送，一个是新创建的
-		fees, err := decoder.wm.EstimateFee(int64(len(usedUTXO)), int64(len(destinations)+1), feesRate)
+		selection, err := selector.Select(unspents, totalSend, estimateFee)
 		if err != nil {
 			return err
 		}
 
-		//如果要手续费有发送支付，得计算加入手续费后，计算余额是否足够
-		//总共要发送的
-		computeTotalSend = totalSend.Add(fees)
-		if computeTotalSend.GreaterThan(balance) {
-			continue
+		usedUTXO = selection.Unspents
+		balance = selection.Balance
+
+		//UTXO如果大于设定限制，则分拆成多笔交易单发送
+		if len(usedUTXO) > decoder.wm.Config.MaxTxInputs {
+			errStr := fmt.Sprintf("The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
+			return errors.New(errStr)
 		}
-		computeTotalSend = totalSend
 
-		actualFees = fees
+		//按找零策略选择找零地址
+		changeAddress, err = decoder.getChangeAddress(wrapper, rawTx, usedUTXO)
+		if err != nil {
+			return err
+		}
 
-		break
+		//按签名后的交易单大小重新计算手续费，剩余部分不够支付找零输出的手续费时不找零
+		remain := balance.Sub(computeTotalSend)
+		withChange := remain.Sub(selection.Fees).GreaterThan(decimal.Zero)
+		exactFees, err := decoder.calculateTxFees(usedUTXO, outputAddrs, feesRate)
+		if err != nil {
+			return err
+		}
+		if withChange {
+			feesOutputs := appendOutput(copyOutputs(outputAddrs), changeAddress, decimal.New(1, -decoder.wm.Decimal()))
+			changeFees, err := decoder.calculateTxFees(usedUTXO, feesOutputs, feesRate)
+			if err != nil {
+				return err
+			}
+			if remain.GreaterThan(changeFees) {
+				exactFees = changeFees
+			} else {
+				withChange = false
+			}
+		}
 
-	}
+		if remain.GreaterThanOrEqual(exactFees) {
+			if withChange {
+				actualFees = exactFees
+			} else {
+				//没有找零时，多出的部分作为手续费
+				actualFees = remain
+			}
+			break
+		}
 
-	//UTXO如果大于设定限制，则分拆成多笔交易单发送
-	if len(usedUTXO) > decoder.wm.Config.MaxTxInputs {
-		errStr := fmt.Sprintf("The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
-		return errors.New(errStr)
+		if tries >= maxFeesReselect {
+			return openwallet.Errorf(openwallet.ErrInsufficientFees, "The balance: %s is not enough to pay fees: %s", balance.String(), exactFees.String())
+		}
+		feesShortfall = feesShortfall.Add(exactFees.Sub(remain))
 	}
 
-	//取账户最后一个地址
-	changeAddress := usedUTXO[0].Address
-
 	changeAmount := balance.Sub(computeTotalSend).Sub(actualFees)
+	//找零低于粉尘限制，直接作为手续费
+	if changeAmount.GreaterThan(decimal.Zero) && changeAmount.LessThan(decoder.wm.Config.DustLimit) {
+		actualFees = actualFees.Add(changeAmount)
+		changeAmount = decimal.Zero
+	}
 	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
 	rawTx.Fees = actualFees.StringFixed(decoder.wm.Decimal())
 
@@ -307,13 +330,6 @@ func (decoder *TransactionDecoder) CreateFIIIRawTransaction(wrapper openwallet.W
 	decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
 	decoder.wm.Log.Std.Notice("-----------------------------------------------")
 
-	//装配输出
-	for to, amount := range rawTx.To {
-		decamount, _ := decimal.NewFromString(amount)
-		outputAddrs = appendOutput(outputAddrs, to, decamount)
-		//outputAddrs[to] = amount
-	}
-
 	//changeAmount := balance.Sub(totalSend).Sub(actualFees)
 	if changeAmount.GreaterThan(decimal.New(0, 0)) {
 		outputAddrs = appendOutput(outputAddrs, changeAddress, changeAmount)
@@ -328,6 +344,201 @@ func (decoder *TransactionDecoder) CreateFIIIRawTransaction(wrapper openwallet.W
 	return nil
 }
 
+//getAccountUnspents 查找账户所有地址的utxo
+func (decoder *TransactionDecoder) getAccountUnspents(wrapper openwallet.WalletDAI, accountID string) ([]*Unspent, error) {
+
+	var (
+		limit = 2000
+	)
+
+	address, err := wrapper.GetAddressList(0, limit, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(address) == 0 {
+		//return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+		return nil, fmt.Errorf("[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range address {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+	//decoder.wm.Log.Debug(searchAddrs)
+	//查找账户的utxo，确认数不少于minConfirmations
+	minConfirmations := decoder.wm.Config.MinConfirmations
+	if decoder.wm.Config.AllowUnconfirmedChange {
+		//未确认的找零也要查出来
+		minConfirmations = 0
+	}
+	unspents, err := decoder.wm.ListUnspent(minConfirmations, searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.wm.Config.AllowUnconfirmedChange {
+		unspents, err = decoder.filterUnconfirmedChange(unspents, searchAddrs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unspents) == 0 {
+		return nil, fmt.Errorf("[%s] balance of more %d confirmations is not enough", accountID, decoder.wm.Config.MinConfirmations)
+	}
+
+	return unspents, nil
+}
+
+//filterUnconfirmedChange 确认数不足的utxo，只保留账户自己发出的交易单的找零
+func (decoder *TransactionDecoder) filterUnconfirmedChange(unspents []*Unspent, accountAddrs []string) ([]*Unspent, error) {
+
+	var (
+		result   = make([]*Unspent, 0)
+		isOwn    = make(map[string]bool)
+		ownTx    = make(map[string]bool)
+		minConfs = decoder.wm.Config.MinConfirmations
+	)
+
+	for _, a := range accountAddrs {
+		isOwn[a] = true
+	}
+
+	for _, u := range unspents {
+		if u.Confirmations >= minConfs {
+			result = append(result, u)
+			continue
+		}
+
+		own, exist := ownTx[u.TxID]
+		if !exist {
+			trx, err := decoder.wm.GetTransaction(u.TxID)
+			if err != nil {
+				return nil, err
+			}
+			//交易单的输入全部属于账户，才是账户自己的找零
+			own = len(trx.Vins) > 0
+			for _, vin := range trx.Vins {
+				if !isOwn[vin.Addr] {
+					own = false
+					break
+				}
+			}
+			ownTx[u.TxID] = own
+		}
+
+		if own {
+			result = append(result, u)
+		}
+	}
+
+	return result, nil
+}
+
+//getFeeRate 交易单未指定费率时，使用节点预估的费率
+func (decoder *TransactionDecoder) getFeeRate(feeRate string) (decimal.Decimal, error) {
+	if len(feeRate) == 0 {
+		return decoder.wm.EstimateFeeRate()
+	}
+	rate, err := decimal.NewFromString(feeRate)
+	if err != nil || rate.LessThan(decimal.Zero) {
+		return decimal.Zero, fmt.Errorf("invalid fee rate: %s", feeRate)
+	}
+	return decoder.wm.LimitFeeRate(rate), nil
+}
+
+//coinSelector 获取交易单使用的utxo选择策略，maxInputs为0时不限制输入数量
+func (decoder *TransactionDecoder) coinSelector(rawTx *openwallet.RawTransaction, maxInputs int) (CoinSelector, error) {
+	name := decoder.wm.Config.CoinSelector
+	if extName := rawTx.GetExtParam().Get("coinSelector").String(); len(extName) > 0 {
+		name = extName
+	}
+	return NewCoinSelector(name, CoinSelectParams{Decimals: decoder.wm.Decimal(), MaxInputs: maxInputs})
+}
+
+//getChangeAddress 获取找零地址，交易单指定的找零地址优先于配置的找零策略
+func (decoder *TransactionDecoder) getChangeAddress(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, usedUTXO []*Unspent) (string, error) {
+
+	var (
+		accountID = rawTx.Account.AccountID
+		limit     = 2000
+	)
+
+	if rawTx.Change != nil && len(rawTx.Change.Address) > 0 {
+		if rawTx.Change.AccountID != accountID {
+			return "", fmt.Errorf("change address: %s is not belong to account: %s", rawTx.Change.Address, accountID)
+		}
+		return rawTx.Change.Address, nil
+	}
+
+	switch decoder.wm.Config.ChangePolicy {
+	case "", ChangePolicyInput:
+		if len(usedUTXO) == 0 {
+			return "", fmt.Errorf("utxo is empty")
+		}
+		return usedUTXO[0].Address, nil
+	case ChangePolicyAccount:
+		//账户索引最小的找零地址
+		addresses, err := decoder.getChangeAddressList(wrapper, accountID, limit)
+		if err != nil {
+			return "", err
+		}
+		return addresses[0].Address, nil
+	case ChangePolicyFresh:
+		//按索引顺序选择没有交易记录、也没有utxo的找零地址，交易记录来自扫块时保存的地址使用记录。
+		//构建交易单时不占用地址，交易单广播并被扫描后才不再作为新的找零地址。
+		addresses, err := decoder.getChangeAddressList(wrapper, accountID, limit)
+		if err != nil {
+			return "", err
+		}
+		searchAddrs := make([]string, 0)
+		for _, a := range addresses {
+			searchAddrs = append(searchAddrs, a.Address)
+		}
+		unspents, err := decoder.wm.ListUnspent(0, searchAddrs...)
+		if err != nil {
+			return "", err
+		}
+		used, err := decoder.wm.Blockscanner.GetUsedAddresses(searchAddrs...)
+		if err != nil {
+			return "", err
+		}
+		for _, u := range unspents {
+			used[u.Address] = true
+		}
+		for _, a := range searchAddrs {
+			if used[a] {
+				continue
+			}
+			return a, nil
+		}
+		return "", openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not unused change address, please create more", accountID)
+	default:
+		return "", fmt.Errorf("unknown change policy: %s", decoder.wm.Config.ChangePolicy)
+	}
+}
+
+//getChangeAddressList 账户的找零地址，按地址索引从小到大排序，不依赖钱包返回的顺序
+func (decoder *TransactionDecoder) getChangeAddressList(wrapper openwallet.WalletDAI, accountID string, limit int) ([]*openwallet.Address, error) {
+
+	addresses, err := wrapper.GetAddressList(0, limit, "AccountID", accountID, "IsChange", true)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not change address", accountID)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].Index != addresses[j].Index {
+			return addresses[i].Index < addresses[j].Index
+		}
+		return addresses[i].Address < addresses[j].Address
+	})
+	return addresses, nil
+}
+
 //SignRawTransaction 签名交易单
 func (decoder *TransactionDecoder) SignFIIIRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
@@ -346,11 +557,13 @@ func (decoder *TransactionDecoder) SignFIIIRawTransaction(wrapper openwallet.Wal
 		for _, keySignature := range keySignatures {
 
 			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
+			if err != nil {
+				return err
+			}
 			keyBytes, err := childKey.GetPrivateKeyBytes()
 			if err != nil {
 				return err
 			}
-			decoder.wm.Log.Debug("privateKey:", hex.EncodeToString(keyBytes))
 
 			//privateKeys = append(privateKeys, keyBytes)
 			txHash := keySignature.Message
@@ -364,16 +577,6 @@ func (decoder *TransactionDecoder) SignFIIIRawTransaction(wrapper openwallet.Wal
 			signature, err := fiiiTransaction.SignTransactionMessage(txHash, keyBytes)
 			if err != nil {
 				return fmt.Errorf("transaction hash sign failed, unexpected error: %v", err)
-			} else {
-
-				//for i, s := range sigPub {
-				//	decoder.wm.Log.Info("第", i+1, "个签名结果")
-				//	decoder.wm.Log.Info()
-				//	decoder.wm.Log.Info("对应的公钥为")
-				//	decoder.wm.Log.Info(hex.EncodeToString(s.Pubkey))
-				//}
-
-				//txHash.Normal.SigPub = *sigPub
 			}
 
 			keySignature.Signature = hex.EncodeToString(signature)
@@ -382,8 +585,6 @@ func (decoder *TransactionDecoder) SignFIIIRawTransaction(wrapper openwallet.Wal
 
 	decoder.wm.Log.Info("transaction hash sign success")
 
-	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
-
 	//decoder.wm.Log.Info("rawTx.Signatures 1:", rawTx.Signatures)
 
 	return nil
@@ -392,58 +593,80 @@ func (decoder *TransactionDecoder) SignFIIIRawTransaction(wrapper openwallet.Wal
 //VerifyRawTransaction 验证交易单，验证交易单并返回加入签名后的交易单
 func (decoder *TransactionDecoder) VerifyFIIIRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
-
 	var (
-		sigPub     = make([]fiiiTransaction.SigPub, 0)
-		//txUnlocks = make([]string, 0)
+		keySignatures = make(map[string]*openwallet.KeySignature)
 	)
 
-	rawHex, err := base64.StdEncoding.DecodeString(rawTx.RawHex)
+	if isMultiSigAccount(rawTx.Account) {
+		return errMultiSigNotSupported()
+	}
+
+	txMsg, err := DecodeTransactionMsg(rawTx.RawHex)
 	if err != nil {
 		return err
 	}
 
-	emptyTrans := string(rawHex)
-
 	if rawTx.Signatures == nil || len(rawTx.Signatures) == 0 {
 		//this.wm.Log.Std.Error("len of signatures error. ")
 		return fmt.Errorf("transaction signature is empty")
 	}
 
-	for accountID, keySignatures := range rawTx.Signatures {
+	for accountID, sigs := range rawTx.Signatures {
 		decoder.wm.Log.Debug("accountID Signatures:", accountID)
-		for _, keySignature := range keySignatures {
-
-			signature, _ := hex.DecodeString(keySignature.Signature)
-			pubkey, _ := hex.DecodeString(keySignature.Address.PublicKey)
-
-			signaturePubkey := fiiiTransaction.SigPub{
-				Signature: signature,
-				Pubkey:    pubkey,
-			}
-
-			sigPub = append(sigPub, signaturePubkey)
+		for _, keySignature := range sigs {
+			keySignatures[strings.ToUpper(keySignature.Message)] = keySignature
 
 			decoder.wm.Log.Debug("Signature:", keySignature.Signature)
 			decoder.wm.Log.Debug("PublicKey:", keySignature.Address.PublicKey)
 		}
 	}
 
-	/////////验证交易单
-	//验证时，对于公钥哈希地址，需要将对应的锁定脚本传入TxUnlock结构体
-	pass, signedTrans, err := fiiiTransaction.VerifyAndCombineTransaction(emptyTrans, sigPub)
-	if pass {
-		decoder.wm.Log.Debug("transaction verify passed")
-		rawTx.IsCompleted = true
-		rawTx.RawHex = base64.StdEncoding.EncodeToString([]byte(signedTrans))
-	} else {
-		decoder.wm.Log.Errorf("transaction verify failed, unexpected error: %v", err)
-		rawTx.IsCompleted = false
+	//按输入顺序匹配签名
+	for i, in := range txMsg.Inputs {
+		keySignature, ok := keySignatures[in.SignMessage()]
+		if !ok {
+			return fmt.Errorf("transaction input[%d] signature is not found", i)
+		}
+
+		signature, err := hex.DecodeString(keySignature.Signature)
+		if err != nil {
+			return fmt.Errorf("transaction input[%d] signature: %s is not hex", i, keySignature.Signature)
+		}
+		pubkey, err := hex.DecodeString(keySignature.Address.PublicKey)
+		if err != nil {
+			return fmt.Errorf("transaction input[%d] public key: %s is not hex", i, keySignature.Address.PublicKey)
+		}
+		if !verifyInputSignature(in, signature, pubkey) {
+			decoder.wm.Log.Errorf("transaction verify failed, input[%d] signature is invalid", i)
+			rawTx.IsCompleted = false
+			return nil
+		}
+		err = txMsg.SetUnlockScript(i, signature, pubkey)
+		if err != nil {
+			return err
+		}
 	}
 
+	//合并签名到交易单
+	txMsg.Complete()
+
+	decoder.wm.Log.Debug("transaction verify passed")
+	rawTx.IsCompleted = true
+	rawTx.RawHex = txMsg.SerializeToHex()
+	rawTx.TxID = txMsg.Hash
+
 	return nil
 }
 
+//verifyInputSignature 验证单个输入的签名，签名的消息为SignMessage
+func verifyInputSignature(in *InputMsg, signature, pubkey []byte) bool {
+	msg, err := hex.DecodeString(in.SignMessage())
+	if err != nil {
+		return false
+	}
+	return owcrypt.Verify(pubkey, nil, 0, msg, uint16(len(msg)), signature, CurveType) == owcrypt.SUCCESS
+}
+
 //GetRawTransactionFeeRate 获取交易单的费率
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
 	rate, err := decoder.wm.EstimateFeeRate()
@@ -469,6 +692,10 @@ func (decoder *TransactionDecoder) CreateFIIISummaryRawTransaction(wrapper openw
 		totalInputAmount   decimal.Decimal
 	)
 
+	if isMultiSigAccount(sumRawTx.Account) {
+		return nil, errMultiSigNotSupported()
+	}
+
 	if minTransfer.LessThan(retainedBalance) {
 		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
 	}
@@ -507,13 +734,9 @@ func (decoder *TransactionDecoder) CreateFIIISummaryRawTransaction(wrapper openw
 	}
 
 	//取得费率
-	if len(sumRawTx.FeeRate) == 0 {
-		feesRate, err = decoder.wm.EstimateFeeRate()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		feesRate, _ = decimal.NewFromString(sumRawTx.FeeRate)
+	feesRate, err = decoder.getFeeRate(sumRawTx.FeeRate)
+	if err != nil {
+		return nil, err
 	}
 
 	sumUnspents = make([]*Unspent, 0)
@@ -521,8 +744,8 @@ func (decoder *TransactionDecoder) CreateFIIISummaryRawTransaction(wrapper openw
 	totalInputAmount = decimal.Zero
 
 	for i, addr := range sumAddresses {
-		//强制6个确认
-		unspents, err := decoder.wm.ListUnspent(6, addr)
+		//汇总的utxo确认数不少于summaryMinConfirmations
+		unspents, err := decoder.wm.ListUnspent(decoder.wm.Config.SummaryMinConfirmations, addr)
 		if err != nil {
 			return nil, err
 		}
@@ -585,13 +808,19 @@ func (decoder *TransactionDecoder) CreateFIIISummaryRawTransaction(wrapper openw
 			rawTx := &openwallet.RawTransaction{
 				Coin:     sumRawTx.Coin,
 				Account:  sumRawTx.Account,
-				FeeRate:  sumRawTx.FeeRate,
+				FeeRate:  feesRate.StringFixed(decoder.wm.Decimal()),
 				To:       raxTxTo,
 				Fees:     fees.StringFixed(decoder.wm.Decimal()),
 				Required: 1,
+				ExtParam: sumRawTx.ExtParam,
 			}
 
-			createErr = decoder.createFIIIRawTransaction(wrapper, rawTx, sumUnspents, outputAddrs)
+			if sumAmount.LessThanOrEqual(decimal.Zero) {
+				//手续费和保留余额超过了输入总数量
+				createErr = openwallet.Errorf(openwallet.ErrInsufficientFees, "summary amount: %s is not enough to pay fees: %s", sumAmount.String(), fees.String())
+			} else {
+				createErr = decoder.createFIIIRawTransaction(wrapper, rawTx, sumUnspents, outputAddrs)
+			}
 			rawTxWithErr := &openwallet.RawTransactionWithError{
 				RawTx: rawTx,
 				Error: openwallet.ConvertError(createErr),
@@ -621,9 +850,8 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 
 	var (
 		err              error
-		vins             = make([]fiiiTransaction.Vin, 0)
-		vouts            = make([]fiiiTransaction.Vout, 0)
 		totalSend        = decimal.New(0, 0)
+		totalInput       = decimal.Zero
 		destinations     = make([]string, 0)
 		accountTotalSent = decimal.Zero
 		txFrom           = make([]string, 0)
@@ -635,8 +863,14 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 		return fmt.Errorf("utxo is empty")
 	}
 
-	if len(to) == 0 {
-		return fmt.Errorf("Receiver addresses is empty! ")
+	if isMultiSigAccount(rawTx.Account) {
+		return errMultiSigNotSupported()
+	}
+
+	//检查所有输出，包括找零
+	err = decoder.ValidateOutputs(to)
+	if err != nil {
+		return err
 	}
 
 	//计算总发送金额
@@ -658,40 +892,41 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 		return errors.New(errStr)
 	}
 
-	//装配输入
+	//锁定时间和过期时间
+	opts, err := decoder.txBuildOptions(rawTx.GetExtParam())
+	if err != nil {
+		return err
+	}
+
+	/////////构建交易单
+	txMsg, err := decoder.newFIIITransactionMsg(usedUTXO, to, opts)
+	if err != nil {
+		return err
+	}
+
 	for _, utxo := range usedUTXO {
-		in := fiiiTransaction.Vin{utxo.TxID, int(utxo.Vout)}
-		vins = append(vins, in)
 		amount := common.IntToDecimals(int64(utxo.Amount), decoder.wm.Decimal())
 		txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, amount))
+		totalInput = totalInput.Add(amount)
 	}
 
-	prefix := fiiicoin_addrdec.FIII_mainnetAddressP2PKH.Prefix
-	if decoder.wm.Config.IsTestNet {
-		prefix = fiiicoin_addrdec.FIII_testnetAddressP2PKH.Prefix
-	}
-
-	//装配输入
 	for to, amount := range to {
 		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amount.String()))
-		amount = amount.Shift(decoder.wm.Decimal())
-		intAmount := uint64(amount.IntPart())
-		out := fiiiTransaction.Vout{prefix, to, int64(intAmount)}
-		vouts = append(vouts, out)
 	}
 
-	version := int(1)
-	locktime := int64(0)
-	expiredtime := int64(0)
-
-	/////////构建空交易单
-	emptyTrans, transHash, err := fiiiTransaction.CreateEmptyTransactionAndMessage(vins, vouts, version, locktime, expiredtime)
-	if err != nil {
-		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
-		//decoder.wm.Log.Error("构建空交易单失败")
+	//实际支付的手续费 = 输入总数量 - 输出总数量，不能低于签名后交易单大小所需的手续费
+	feesDec := totalInput.Sub(totalSend)
+	if feesRate, rateErr := decimal.NewFromString(rawTx.FeeRate); rateErr == nil {
+		requiredFees := decoder.wm.CalculateFee(txMsg.EstimateSignedSize(), feesRate)
+		if feesDec.LessThan(requiredFees) {
+			return openwallet.Errorf(openwallet.ErrInsufficientFees, "the fees: %s is less than required fees: %s of transaction size: %d", feesDec.String(), requiredFees.String(), txMsg.EstimateSignedSize())
+		}
+	} else if feesDec.LessThan(decimal.Zero) {
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "the outputs: %s is greater than inputs: %s", totalSend.String(), totalInput.String())
 	}
+	rawTx.Fees = feesDec.StringFixed(decoder.wm.Decimal())
 
-	rawTx.RawHex = base64.StdEncoding.EncodeToString([]byte(emptyTrans))
+	rawTx.RawHex = txMsg.SerializeToHex()
 
 	if rawTx.Signatures == nil {
 		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
@@ -702,7 +937,10 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 
 	for i, utxo := range usedUTXO {
 
-		beSignHex := transHash[i]
+		beSignHex, err := txMsg.SignMessage(i)
+		if err != nil {
+			return err
+		}
 
 		decoder.wm.Log.Std.Debug("txHash[%d]: %s", i, beSignHex)
 		//beSignHex := transHash[i]
@@ -723,12 +961,9 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 
 	}
 
-	feesDec, _ := decimal.NewFromString(rawTx.Fees)
 	accountTotalSent = accountTotalSent.Add(feesDec)
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
-	//TODO:多重签名要使用owner的公钥填充
-
 	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
@@ -738,6 +973,51 @@ func (decoder *TransactionDecoder) createFIIIRawTransaction(
 	return nil
 }
 
+//newFIIITransactionMsg 使用utxo和输出构建未签名的交易单
+func (decoder *TransactionDecoder) newFIIITransactionMsg(usedUTXO []*Unspent, to map[string]decimal.Decimal, opts *TxBuildOptions) (*TransactionMsg, error) {
+
+	if opts == nil {
+		opts = DefaultTxBuildOptions()
+	}
+
+	txMsg := NewTransactionMsg(opts.Version, opts.LockTime, opts.ExpiredTime)
+
+	//装配输入
+	for _, utxo := range usedUTXO {
+		err := txMsg.AddInput(utxo.TxID, utxo.Vout)
+		if err != nil {
+			return nil, fmt.Errorf("create transaction failed, unexpected error: %v", err)
+		}
+	}
+
+	//装配输出
+	for to, amount := range to {
+		err := txMsg.AddOutput(to, amount.Shift(decoder.wm.Decimal()).IntPart(), decoder.wm.Config.IsTestNet)
+		if err != nil {
+			return nil, fmt.Errorf("create transaction failed, unexpected error: %v", err)
+		}
+	}
+
+	return txMsg, nil
+}
+
+//calculateTxFees 构建未签名的交易单，按签名后的大小计算手续费
+func (decoder *TransactionDecoder) calculateTxFees(usedUTXO []*Unspent, to map[string]decimal.Decimal, feesRate decimal.Decimal) (decimal.Decimal, error) {
+	txMsg, err := decoder.newFIIITransactionMsg(usedUTXO, to, nil)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decoder.wm.CalculateFee(txMsg.EstimateSignedSize(), feesRate), nil
+}
+
+func copyOutputs(output map[string]decimal.Decimal) map[string]decimal.Decimal {
+	outputCopy := make(map[string]decimal.Decimal, len(output))
+	for address, amount := range output {
+		outputCopy[address] = amount
+	}
+	return outputCopy
+}
+
 func appendOutput(output map[string]decimal.Decimal, address string, amount decimal.Decimal) map[string]decimal.Decimal {
 	if origin, ok := output[address]; ok {
 		origin = origin.Add(amount)
@@ -746,4 +1026,14 @@ func appendOutput(output map[string]decimal.Decimal, address string, amount deci
 		output[address] = amount
 	}
 	return output
-}
\ No newline at end of file
+}
+
+//isMultiSigAccount 是否多重签名账户
+func isMultiSigAccount(account *openwallet.AssetsAccount) bool {
+	return account != nil && len(account.OwnerKeys) > 1
+}
+
+//errMultiSigNotSupported 多重签名的脚本格式未经节点验证，暂不支持
+func errMultiSigNotSupported() error {
+	return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig account is not supported")
+}
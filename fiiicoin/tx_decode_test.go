@@ -0,0 +1,214 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//testWalletDAI 内存中的钱包地址，GetAddressList支持按AccountID、Address、IsChange过滤
+type testWalletDAI struct {
+	openwallet.WalletDAIBase
+	addresses []*openwallet.Address
+}
+
+func (dai *testWalletDAI) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	list := make([]*openwallet.Address, 0)
+	for _, a := range dai.addresses {
+		match := true
+		for i := 0; i+1 < len(cols); i += 2 {
+			switch cols[i] {
+			case "AccountID":
+				match = match && a.AccountID == cols[i+1]
+			case "Address":
+				match = match && a.Address == cols[i+1]
+			case "IsChange":
+				match = match && a.IsChange == cols[i+1]
+			}
+		}
+		if match {
+			list = append(list, a)
+		}
+	}
+	if offset > len(list) {
+		offset = len(list)
+	}
+	list = list[offset:]
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (dai *testWalletDAI) GetAddress(address string) (*openwallet.Address, error) {
+	for _, a := range dai.addresses {
+		if a.Address == address {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("address: %s not found", address)
+}
+
+func TestGetChangeAddress(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	//change1有utxo，change2收到后又全部花费，change3没有使用过
+	node.AddBlock(NewMockCoinbase(mockAddressA, 5000000000, 1))
+	toChange2 := NewMockCoinbase("change2", 1000000000, 2)
+	node.AddBlock(NewMockCoinbase("change1", 1000000000, 3), toChange2)
+	node.AddBlock(NewMockTransaction(
+		[]*MockInput{{OutputTransactionHash: toChange2.Hash, OutputIndex: 0, Amount: 1000000000, AccountID: "change2"}},
+		[]*MockOutput{{Amount: 999000000, ReceiverID: mockAddressA}},
+	))
+
+	dir, err := ioutil.TempDir("", "fiiicoin")
+	if err != nil {
+		t.Errorf("TempDir failed unexpected error: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bs, _, _ := testMockScanner(node, dir)
+	bs.SetBlockScanTargetFunc(func(target openwallet.ScanTarget) (string, bool) {
+		return "account", target.Address != mockAddressA
+	})
+	bs.ScanBlockTask()
+
+	//钱包返回的顺序与地址索引相反
+	wrapper := &testWalletDAI{}
+	for i, addr := range []string{"change4", "change3", "change2", "change1", mockAddressA} {
+		wrapper.addresses = append(wrapper.addresses, &openwallet.Address{AccountID: "account", Address: addr, IsChange: addr != mockAddressA, Index: uint64(4 - i)})
+	}
+	rawTx := &openwallet.RawTransaction{Account: &openwallet.AssetsAccount{AccountID: "account"}}
+	usedUTXO := []*Unspent{{Address: mockAddressA}}
+	decoder := NewTransactionDecoder(bs.wm)
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{ChangePolicyInput, mockAddressA},
+		{ChangePolicyAccount, "change1"},
+		{ChangePolicyFresh, "change3"},
+	}
+	for _, test := range tests {
+		bs.wm.Config.ChangePolicy = test.policy
+		address, err := decoder.getChangeAddress(wrapper, rawTx, usedUTXO)
+		if err != nil || address != test.want {
+			t.Errorf("policy: %s change address: %s, error: %v, want: %s", test.policy, address, err, test.want)
+		}
+	}
+
+	//构建交易单不占用地址，change3在链上使用前一直可用
+	if address, err := decoder.getChangeAddress(wrapper, rawTx, usedUTXO); err != nil || address != "change3" {
+		t.Errorf("fresh policy change address: %s, error: %v, want: change3", address, err)
+	}
+
+	//change3在链上收到转账后选择下一个
+	node.AddBlock(NewMockCoinbase("change3", 1000000000, 5))
+	bs.ScanBlockTask()
+	if address, err := decoder.getChangeAddress(wrapper, rawTx, usedUTXO); err != nil || address != "change4" {
+		t.Errorf("fresh policy change address: %s, error: %v, want: change4", address, err)
+	}
+
+	//交易单指定的找零地址优先
+	rawTx.Change = &openwallet.Address{AccountID: "account", Address: "change2"}
+	if address, err := decoder.getChangeAddress(wrapper, rawTx, usedUTXO); err != nil || address != "change2" {
+		t.Errorf("specified change address: %s, error: %v", address, err)
+	}
+}
+
+func TestMultiSigAccountNotSupported(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	decoder := NewTransactionDecoder(testMockWalletManager(node))
+	wrapper := &testWalletDAI{}
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account", OwnerKeys: []string{"owner1", "owner2"}, Required: 2},
+	}
+	usedUTXO := testUnspents(mockAddressA, 100000000)
+
+	err := decoder.createFIIIRawTransaction(wrapper, rawTx, usedUTXO, map[string]decimal.Decimal{mockAddressB: decimal.New(5, -1)})
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrCreateRawTransactionFailed {
+		t.Errorf("create multisig transaction should fail, got: %v", err)
+	}
+
+	if err := decoder.VerifyFIIIRawTransaction(wrapper, rawTx); err == nil {
+		t.Errorf("verify multisig transaction should fail")
+	}
+
+	//选币前拒绝，不会按单签大小估算手续费
+	rawTx.To = map[string]string{mockAddressB: "0.5"}
+	if err := decoder.CreateFIIIRawTransaction(wrapper, rawTx); err == nil {
+		t.Errorf("create multisig transaction should fail before coin selection")
+	}
+	if _, err := decoder.CreateFIIISplitRawTransaction(wrapper, rawTx); err == nil {
+		t.Errorf("split multisig transaction should fail before coin selection")
+	}
+}
+
+func TestBuildFIIIRawTransaction(t *testing.T) {
+	node := NewMockNode()
+	defer node.Close()
+
+	//主网地址才能通过校验和检查，找零也回到该地址
+	const address = "fiiimU5jzazxf7B9naGSQauE5XwPCZBKajiQe2"
+
+	wm := testMockWalletManager(node)
+	decoder := NewTransactionDecoder(wm)
+	wrapper := &testWalletDAI{addresses: []*openwallet.Address{{AccountID: "account", Address: address}}}
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{address: "0.5"},
+		FeeRate: "0.001",
+	}
+
+	err := decoder.buildFIIIRawTransaction(wrapper, rawTx, testUnspents(address, 30000000, 40000000))
+	if err != nil {
+		t.Errorf("buildFIIIRawTransaction failed unexpected error: %v", err)
+		return
+	}
+
+	txMsg, err := DecodeTransactionMsg(rawTx.RawHex)
+	if err != nil || len(txMsg.Inputs) != 2 || len(txMsg.Outputs) == 0 {
+		t.Errorf("unexpected transaction: %+v, error: %v", txMsg, err)
+		return
+	}
+
+	//手续费按签名后的大小计算，剩余部分找零
+	fees := wm.CalculateFee(txMsg.EstimateSignedSize(), decimal.RequireFromString(rawTx.FeeRate))
+	if rawTx.Fees != fees.StringFixed(wm.Decimal()) {
+		t.Errorf("fees: %s, want: %s", rawTx.Fees, fees.StringFixed(wm.Decimal()))
+	}
+	var outputs int64
+	for _, out := range txMsg.Outputs {
+		outputs += out.Amount
+	}
+	if outputs+fees.Shift(wm.Decimal()).IntPart() != 70000000 {
+		t.Errorf("outputs: %d and fees: %s should spend all inputs", outputs, fees.String())
+	}
+	if len(rawTx.Signatures["account"]) != 2 {
+		t.Errorf("key signatures: %d, want 2", len(rawTx.Signatures["account"]))
+	}
+}
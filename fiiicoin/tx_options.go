@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	//交易单版本
+	TxVersion = int32(1)
+	//锁定时间小于该值表示区块高度，否则表示毫秒时间戳
+	LockTimeThreshold = int64(500000000)
+)
+
+//TxBuildOptions 构建交易单的选项
+type TxBuildOptions struct {
+	Version     int32
+	LockTime    int64 //锁定到的区块高度或毫秒时间戳，0不锁定
+	ExpiredTime int64 //过期的毫秒时间戳，0不过期
+}
+
+//DefaultTxBuildOptions 默认选项，不锁定不过期
+func DefaultTxBuildOptions() *TxBuildOptions {
+	return &TxBuildOptions{
+		Version: TxVersion,
+	}
+}
+
+//IsLockByHeight 锁定时间是否为区块高度
+func (opts *TxBuildOptions) IsLockByHeight() bool {
+	return opts.LockTime > 0 && opts.LockTime < LockTimeThreshold
+}
+
+//Validate 根据当前区块高度和时间检查选项
+func (opts *TxBuildOptions) Validate(info *BlockchainInfo) error {
+
+	if opts.LockTime < 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid lock time: %d", opts.LockTime)
+	}
+
+	if opts.ExpiredTime < 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid expired time: %d", opts.ExpiredTime)
+	}
+
+	if opts.ExpiredTime == 0 {
+		return nil
+	}
+
+	if info == nil {
+		return fmt.Errorf("blockchain info is empty")
+	}
+
+	if uint64(opts.ExpiredTime) <= info.LocalLastBlockTime {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "expired time: %d is not after the last block time: %d", opts.ExpiredTime, info.LocalLastBlockTime)
+	}
+
+	if opts.LockTime > 0 && !opts.IsLockByHeight() && opts.LockTime >= opts.ExpiredTime {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "lock time: %d is not before expired time: %d", opts.LockTime, opts.ExpiredTime)
+	}
+
+	return nil
+}
+
+//txBuildOptions 从交易单扩展参数读取锁定时间和过期时间，并根据区块链信息检查
+/*
+	extParam: {
+		"lockTime": 锁定到的区块高度（小于500000000）或毫秒时间戳,
+		"expiredTime": 过期的毫秒时间戳
+	}
+*/
+func (decoder *TransactionDecoder) txBuildOptions(ext gjson.Result) (*TxBuildOptions, error) {
+
+	opts := DefaultTxBuildOptions()
+	opts.LockTime = ext.Get("lockTime").Int()
+	opts.ExpiredTime = ext.Get("expiredTime").Int()
+
+	if opts.LockTime == 0 && opts.ExpiredTime == 0 {
+		return opts, nil
+	}
+
+	info, err := decoder.wm.GetBlockChainInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	err = opts.Validate(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IsLockByHeight() && uint64(opts.LockTime) > info.LocalLastBlockHeight {
+		decoder.wm.Log.Std.Notice("Transaction is locked until block height: %d, current height: %d", opts.LockTime, info.LocalLastBlockHeight)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"testing"
+)
+
+func TestTxBuildOptions_Validate(t *testing.T) {
+	info := &BlockchainInfo{
+		LocalLastBlockHeight: 100000,
+		LocalLastBlockTime:   1546443912218,
+	}
+
+	tests := []struct {
+		opts  TxBuildOptions
+		valid bool
+	}{
+		{TxBuildOptions{}, true},
+		{TxBuildOptions{LockTime: 100010}, true},
+		{TxBuildOptions{LockTime: 1546443999999, ExpiredTime: 1546449999999}, true},
+		{TxBuildOptions{ExpiredTime: 1546443912218}, false},
+		{TxBuildOptions{LockTime: 1546449999999, ExpiredTime: 1546443999999}, false},
+		{TxBuildOptions{LockTime: -1}, false},
+	}
+
+	for i, test := range tests {
+		err := test.opts.Validate(info)
+		if test.valid && err != nil {
+			t.Errorf("case[%d] failed unexpected error: %v", i, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("case[%d] should be invalid", i)
+		}
+	}
+}
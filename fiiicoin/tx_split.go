@@ -0,0 +1,352 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"sort"
+)
+
+const (
+	SplitModePayment     = "payment"     //拆分成多笔付款交易单，合计满足转账数量
+	SplitModeConsolidate = "consolidate" //先返回合并utxo的交易单，确认后再重新发起转账
+)
+
+//splitTxPlan 拆分交易单的计划
+type splitTxPlan struct {
+	unspents []*Unspent
+	outputs  map[string]decimal.Decimal //包括找零
+	to       map[string]decimal.Decimal //不包括找零
+	fees     decimal.Decimal
+}
+
+//CreateSplitRawTransaction 创建交易单，使用的utxo超过MaxTxInputs时，按拆分模式返回多笔交易单
+func (decoder *TransactionDecoder) CreateSplitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+	if rawTx.Coin.IsContract {
+		return nil, fmt.Errorf("do not support token transaction")
+	} else {
+		return decoder.CreateFIIISplitRawTransaction(wrapper, rawTx)
+	}
+}
+
+//CreateFIIISplitRawTransaction 创建FIII交易单，输入数量超过限制时拆分成多笔
+func (decoder *TransactionDecoder) CreateFIIISplitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	var (
+		plans        []*splitTxPlan
+		totalSend    = decimal.Zero
+		destinations = make([]string, 0)
+		rawTxArray   = make([]*openwallet.RawTransactionWithError, 0)
+	)
+
+	if isMultiSigAccount(rawTx.Account) {
+		return nil, errMultiSigNotSupported()
+	}
+
+	//检查接收地址和数量
+	receivers, err := decoder.ValidateReceivers(rawTx.To)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := decoder.wm.Config.SplitMode
+	if extMode := rawTx.GetExtParam().Get("splitMode").String(); len(extMode) > 0 {
+		mode = extMode
+	}
+	if mode != SplitModePayment && mode != SplitModeConsolidate {
+		return nil, fmt.Errorf("unknown split mode: %s", mode)
+	}
+
+	unspents, err := decoder.getAccountUnspents(wrapper, rawTx.Account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	feesRate, err := decoder.getFeeRate(rawTx.FeeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	for addr, deamount := range receivers {
+		totalSend = totalSend.Add(deamount)
+		destinations = append(destinations, addr)
+	}
+	sort.Strings(destinations)
+
+	//不限制输入数量，超过最大输入数量时才需要拆分
+	selector, err := decoder.coinSelector(rawTx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	estimateFee := func(inputs int, withChange bool) (decimal.Decimal, error) {
+		outputs := len(destinations)
+		if withChange {
+			outputs = outputs + 1
+		}
+		return decoder.wm.EstimateFee(int64(inputs), int64(outputs), feesRate)
+	}
+
+	selection, err := selector.Select(unspents, totalSend, estimateFee)
+	if err != nil {
+		return nil, err
+	}
+
+	//没有超过最大输入数量，只需要一笔交易单
+	if len(selection.Unspents) <= decoder.wm.Config.MaxTxInputs {
+		createErr := decoder.buildFIIIRawTransaction(wrapper, rawTx, unspents)
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+		return rawTxArray, nil
+	}
+
+	//使用第一个输入地址找零时，每笔交易单各自找零到自己的第一个输入地址
+	changeAddress := ""
+	if policy := decoder.wm.Config.ChangePolicy; (policy != "" && policy != ChangePolicyInput) || rawTx.Change != nil {
+		changeAddress, err = decoder.getChangeAddress(wrapper, rawTx, selection.Unspents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == SplitModeConsolidate {
+		plans, err = decoder.planConsolidateTransactions(selection.Unspents, changeAddress, feesRate)
+	} else {
+		//按拆分后每笔交易单的手续费重新选择utxo
+		maxInputs := decoder.wm.Config.MaxTxInputs
+		splitEstimateFee := func(inputs int, withChange bool) (decimal.Decimal, error) {
+			total := decimal.Zero
+			for begin := 0; begin < inputs; begin += maxInputs {
+				n := inputs - begin
+				if n > maxInputs {
+					n = maxInputs
+				}
+				fees, feeErr := decoder.wm.EstimateFee(int64(n), int64(len(destinations)+1), feesRate)
+				if feeErr != nil {
+					return decimal.Zero, feeErr
+				}
+				total = total.Add(fees)
+			}
+			return total, nil
+		}
+		selection, err = selector.Select(unspents, totalSend, splitEstimateFee)
+		if err != nil {
+			return nil, err
+		}
+		plans, err = decoder.planSplitPaymentTransactions(receivers, selection.Unspents, changeAddress, feesRate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder.wm.Log.Std.Notice("Transaction use %d inputs over: %d, split into %d transactions by mode: %s",
+		len(selection.Unspents), decoder.wm.Config.MaxTxInputs, len(plans), mode)
+
+	for _, plan := range plans {
+
+		raxTxTo := make(map[string]string, 0)
+		for a, m := range plan.to {
+			raxTxTo[a] = m.StringFixed(decoder.wm.Decimal())
+		}
+
+		//创建一笔交易单
+		splitRawTx := &openwallet.RawTransaction{
+			Coin:     rawTx.Coin,
+			Account:  rawTx.Account,
+			FeeRate:  feesRate.StringFixed(decoder.wm.Decimal()),
+			To:       raxTxTo,
+			Fees:     plan.fees.StringFixed(decoder.wm.Decimal()),
+			Required: 1,
+			ExtParam: rawTx.ExtParam,
+		}
+
+		createErr := decoder.createFIIIRawTransaction(wrapper, splitRawTx, plan.unspents, plan.outputs)
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: splitRawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxArray, nil
+}
+
+//planSplitPaymentTransactions 按选择策略返回的utxo顺序每MaxTxInputs个为一笔交易单，依次支付接收地址，直到全部支付完成
+//changeAddress为空时找零到每笔交易单的第一个输入地址。
+//部分支付时，留给下一笔交易单的数量和本笔支付的数量都不低于粉尘限制。
+func (decoder *TransactionDecoder) planSplitPaymentTransactions(receivers map[string]decimal.Decimal, unspents []*Unspent, changeAddress string, feesRate decimal.Decimal) ([]*splitTxPlan, error) {
+
+	var (
+		plans        = make([]*splitTxPlan, 0)
+		values       = unspents
+		destinations = make([]string, 0, len(receivers))
+		remaining    = make(map[string]decimal.Decimal)
+		remainTotal  = decimal.Zero
+		maxInputs    = decoder.wm.Config.MaxTxInputs
+		dustLimit    = decoder.wm.Config.DustLimit
+	)
+
+	for addr, amount := range receivers {
+		destinations = append(destinations, addr)
+		remaining[addr] = amount
+		remainTotal = remainTotal.Add(amount)
+	}
+	sort.Strings(destinations)
+
+	for begin := 0; begin < len(values) && remainTotal.GreaterThan(decimal.Zero); begin += maxInputs {
+		end := begin + maxInputs
+		if end > len(values) {
+			end = len(values)
+		}
+
+		batch := values[begin:end]
+		balance := decimal.Zero
+		for _, u := range batch {
+			balance = balance.Add(unspentAmount(u, decoder.wm.Decimal()))
+		}
+
+		//手续费按未支付完成的接收地址加一个找零输出计算
+		pending := 0
+		for _, addr := range destinations {
+			if remaining[addr].GreaterThan(decimal.Zero) {
+				pending++
+			}
+		}
+		fees, err := decoder.wm.EstimateFee(int64(len(batch)), int64(pending+1), feesRate)
+		if err != nil {
+			return nil, err
+		}
+
+		//不足以支付手续费和一个粉尘限制输出的批次直接报错，不能丢弃其中的utxo
+		available := balance.Sub(fees)
+		if available.LessThan(dustLimit) {
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the inputs: %d balance: %s of split transaction is not enough to pay fees: %s", len(batch), balance.StringFixed(decoder.wm.Decimal()), fees.StringFixed(decoder.wm.Decimal()))
+		}
+
+		plan := &splitTxPlan{
+			unspents: batch,
+			outputs:  make(map[string]decimal.Decimal),
+			to:       make(map[string]decimal.Decimal),
+			fees:     fees,
+		}
+
+		for _, addr := range destinations {
+			need := remaining[addr]
+			if need.LessThanOrEqual(decimal.Zero) {
+				continue
+			}
+			pay := decimal.Min(need, available)
+			//剩余未支付的数量低于粉尘限制时，少付一些，留出粉尘限制的数量到下一笔交易单
+			if pay.LessThan(need) && need.Sub(pay).LessThan(dustLimit) {
+				pay = need.Sub(dustLimit)
+			}
+			//本笔可支付的数量低于粉尘限制，留到下一笔交易单
+			if pay.LessThan(dustLimit) {
+				break
+			}
+			plan.to = appendOutput(plan.to, addr, pay)
+			plan.outputs = appendOutput(plan.outputs, addr, pay)
+			remaining[addr] = need.Sub(pay)
+			remainTotal = remainTotal.Sub(pay)
+			available = available.Sub(pay)
+			if available.LessThanOrEqual(decimal.Zero) {
+				break
+			}
+		}
+
+		//没有支付任何接收地址的批次不使用
+		if len(plan.to) == 0 {
+			continue
+		}
+
+		//最后一笔交易单可能有找零，低于粉尘限制的找零作为手续费
+		if available.GreaterThan(decimal.Zero) && available.LessThan(dustLimit) {
+			plan.fees = plan.fees.Add(available)
+		} else if available.GreaterThan(decimal.Zero) {
+			plan.outputs = appendOutput(plan.outputs, batchChangeAddress(batch, changeAddress), available)
+		}
+
+		plans = append(plans, plan)
+	}
+
+	if remainTotal.GreaterThan(decimal.Zero) {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance is not enough to split transaction, still need: %s", remainTotal.StringFixed(decoder.wm.Decimal()))
+	}
+
+	return plans, nil
+}
+
+//planConsolidateTransactions 把选中的utxo每MaxTxInputs个合并到一个输出，确认后再重新发起转账
+//changeAddress为空时合并到每笔交易单的第一个输入地址，少于2个输入的批次不需要合并
+func (decoder *TransactionDecoder) planConsolidateTransactions(unspents []*Unspent, changeAddress string, feesRate decimal.Decimal) ([]*splitTxPlan, error) {
+
+	var (
+		plans     = make([]*splitTxPlan, 0)
+		maxInputs = decoder.wm.Config.MaxTxInputs
+	)
+
+	for begin := 0; begin < len(unspents); begin += maxInputs {
+		end := begin + maxInputs
+		if end > len(unspents) {
+			end = len(unspents)
+		}
+
+		batch := unspents[begin:end]
+		if len(batch) < 2 {
+			continue
+		}
+
+		balance := decimal.Zero
+		for _, u := range batch {
+			balance = balance.Add(unspentAmount(u, decoder.wm.Decimal()))
+		}
+
+		fees, err := decoder.wm.EstimateFee(int64(len(batch)), 1, feesRate)
+		if err != nil {
+			return nil, err
+		}
+
+		amount := balance.Sub(fees)
+		if amount.LessThanOrEqual(decimal.Zero) {
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the balance: %s of consolidation is not enough to pay fees: %s", balance.String(), fees.String())
+		}
+
+		to := map[string]decimal.Decimal{batchChangeAddress(batch, changeAddress): amount}
+		plans = append(plans, &splitTxPlan{
+			unspents: batch,
+			outputs:  to,
+			to:       to,
+			fees:     fees,
+		})
+	}
+
+	if len(plans) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "no batch has at least 2 inputs to consolidate")
+	}
+
+	return plans, nil
+}
+
+//batchChangeAddress 拆分交易单的找零地址
+func batchChangeAddress(batch []*Unspent, changeAddress string) string {
+	if len(changeAddress) > 0 {
+		return changeAddress
+	}
+	return batch[0].Address
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func testSplitDecoder(maxInputs int) *TransactionDecoder {
+	wm := NewWalletManager()
+	wm.Config.MaxTxInputs = maxInputs
+	return NewTransactionDecoder(wm)
+}
+
+func TestPlanSplitPaymentTransactions(t *testing.T) {
+	decoder := testSplitDecoder(3)
+	feesRate, _ := decimal.NewFromString("0.001")
+
+	//10个0.1的utxo，支付0.75，每笔交易单最多3个输入
+	amounts := make([]uint64, 10)
+	for i := range amounts {
+		amounts[i] = 10000000
+	}
+	utxos := testUnspents("addr1", amounts...)
+	receivers := map[string]decimal.Decimal{"receiver1": decimal.New(5, -1), "receiver2": decimal.New(25, -2)}
+
+	plans, err := decoder.planSplitPaymentTransactions(receivers, utxos, "", feesRate)
+	if err != nil {
+		t.Fatalf("planSplitPaymentTransactions failed unexpected error: %v\n", err)
+	}
+
+	paid := decimal.Zero
+	for i, plan := range plans {
+		if len(plan.unspents) > 3 {
+			t.Errorf("plan[%d] inputs: %d over max inputs", i, len(plan.unspents))
+		}
+		input := decimal.Zero
+		for _, u := range plan.unspents {
+			input = input.Add(unspentAmount(u, decoder.wm.Decimal()))
+		}
+		output := decimal.Zero
+		for _, amount := range plan.outputs {
+			output = output.Add(amount)
+		}
+		if !input.Equal(output.Add(plan.fees)) {
+			t.Errorf("plan[%d] input: %s is not equal to output: %s + fees: %s", i, input, output, plan.fees)
+		}
+		for _, amount := range plan.to {
+			paid = paid.Add(amount)
+		}
+		t.Logf("plan[%d] inputs: %d, to: %v, fees: %s", i, len(plan.unspents), plan.to, plan.fees)
+	}
+
+	if !paid.Equal(decimal.New(75, -2)) {
+		t.Errorf("total paid: %s, expected: 0.75", paid)
+	}
+
+	receivers["receiver1"] = decimal.New(2, 0)
+	_, err = decoder.planSplitPaymentTransactions(receivers, utxos, "", feesRate)
+	if err == nil {
+		t.Errorf("split transaction should be failed when balance is not enough")
+	}
+}
+
+func TestPlanConsolidateTransactions(t *testing.T) {
+	decoder := testSplitDecoder(3)
+	feesRate, _ := decimal.NewFromString("0.001")
+
+	//最后一批只有1个utxo，不需要合并
+	utxos := testUnspents("addr1", 10000000, 10000000, 10000000, 10000000, 10000000, 10000000, 10000000)
+	plans, err := decoder.planConsolidateTransactions(utxos, "change", feesRate)
+	if err != nil {
+		t.Fatalf("planConsolidateTransactions failed unexpected error: %v\n", err)
+	}
+
+	if len(plans) != 2 {
+		t.Errorf("consolidation transactions: %d, expected: 2", len(plans))
+	}
+	for i, plan := range plans {
+		if len(plan.unspents) < 2 {
+			t.Errorf("plan[%d] inputs: %d, expected at least 2", i, len(plan.unspents))
+		}
+		if len(plan.outputs) != 1 {
+			t.Errorf("plan[%d] outputs: %d, expected: 1", i, len(plan.outputs))
+		}
+		if _, ok := plan.outputs["change"]; !ok {
+			t.Errorf("plan[%d] should be consolidated to change address", i)
+		}
+	}
+}
+
+func TestPlanSplitPaymentTransactions_DustRemainder(t *testing.T) {
+	decoder := testSplitDecoder(2)
+	feesRate, _ := decimal.NewFromString("0.001")
+	dustLimit := decoder.wm.Config.DustLimit
+
+	//第一批的utxo支付后只差0.000005，低于粉尘限制
+	need := decimal.New(1, -1)
+	fees, _ := decoder.wm.EstimateFee(2, 2, feesRate)
+	first := need.Add(fees).Sub(decimal.New(5, -6)).Shift(Decimals).IntPart()
+	utxos := testUnspents("addr1", uint64(first)-uint64(first)/2, uint64(first)/2, 10000000, 10000000)
+
+	plans, err := decoder.planSplitPaymentTransactions(map[string]decimal.Decimal{"receiver1": need}, utxos, "", feesRate)
+	if err != nil {
+		t.Fatalf("planSplitPaymentTransactions failed unexpected error: %v\n", err)
+	}
+
+	paid := decimal.Zero
+	for i, plan := range plans {
+		for addr, amount := range plan.outputs {
+			if amount.LessThan(dustLimit) {
+				t.Errorf("plan[%d] output: %s amount: %s is less than dust limit", i, addr, amount)
+			}
+		}
+		for _, amount := range plan.to {
+			paid = paid.Add(amount)
+		}
+		t.Logf("plan[%d] inputs: %d, outputs: %v, fees: %s", i, len(plan.unspents), plan.outputs, plan.fees)
+	}
+
+	if len(plans) != 2 || !paid.Equal(need) {
+		t.Errorf("plans: %d, total paid: %s, expected: 2 plans paid %s", len(plans), paid, need)
+		return
+	}
+
+	//第一笔少付粉尘限制的数量，第二笔支付的数量正好等于粉尘限制，边界上允许创建
+	if !plans[1].to["receiver1"].Equal(dustLimit) {
+		t.Errorf("second plan paid: %s, expected exactly dust limit: %s", plans[1].to["receiver1"], dustLimit)
+	}
+}
+
+func TestPlanSplitPaymentTransactions_InsufficientFees(t *testing.T) {
+	decoder := testSplitDecoder(2)
+	feesRate, _ := decimal.NewFromString("0.001")
+
+	//第一批的2个utxo不够支付手续费，不能被跳过
+	utxos := testUnspents("addr1", 1000, 1000, 10000000, 10000000)
+	_, err := decoder.planSplitPaymentTransactions(map[string]decimal.Decimal{"receiver1": decimal.New(1, -1)}, utxos, "", feesRate)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrInsufficientFees {
+		t.Errorf("split transaction should fail with insufficient fees, got: %v", err)
+	}
+}
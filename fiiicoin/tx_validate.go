@@ -0,0 +1,129 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/blocktree/fiiicoin-adapter/fiiicoin_addrdec"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+//ValidateAddress 检查FIII地址的前缀和校验和
+func (decoder *TransactionDecoder) ValidateAddress(address string) error {
+	cfg := fiiicoin_addrdec.FIII_mainnetAddressP2PKH
+	if decoder.wm.Config.IsTestNet {
+		cfg = fiiicoin_addrdec.FIII_testnetAddressP2PKH
+	}
+
+	hash, err := fiiicoin_addrdec.Default.AddressDecode(address, cfg)
+	if err != nil || len(hash) != cfg.HashLen {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid address: %s", address)
+	}
+	return nil
+}
+
+//ParseAmount 解析转账数量，小数位不能超过币种精度
+func (decoder *TransactionDecoder) ParseAmount(amount string) (decimal.Decimal, error) {
+	dec, err := decimal.NewFromString(strings.TrimSpace(amount))
+	if err != nil {
+		return decimal.Zero, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid amount: %s", amount)
+	}
+
+	if !dec.Shift(decoder.wm.Decimal()).Equal(dec.Shift(decoder.wm.Decimal()).Truncate(0)) {
+		return decimal.Zero, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s has more than %d decimals", amount, decoder.wm.Decimal())
+	}
+
+	return dec, nil
+}
+
+//ValidateReceivers 检查接收地址和数量，返回解析后的数量
+func (decoder *TransactionDecoder) ValidateReceivers(to map[string]string) (map[string]decimal.Decimal, error) {
+
+	var (
+		receivers  = make(map[string]decimal.Decimal)
+		normalized = make(map[string]string)
+	)
+
+	if len(to) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "Receiver addresses is empty!")
+	}
+
+	//去掉空白后相同的地址视为重复
+	for addr := range to {
+		key := strings.TrimSpace(addr)
+		if origin, exist := normalized[key]; exist {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "duplicate receiver address: %s and %s", origin, addr)
+		}
+		normalized[key] = addr
+	}
+
+	for addr, amount := range to {
+
+		if addr != strings.TrimSpace(addr) {
+			return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "invalid address: %s", addr)
+		}
+
+		dec, err := decoder.ParseAmount(amount)
+		if err != nil {
+			return nil, err
+		}
+
+		err = decoder.validateOutput(addr, dec)
+		if err != nil {
+			return nil, err
+		}
+
+		receivers[addr] = dec
+	}
+
+	return receivers, nil
+}
+
+//ValidateOutputs 检查构建交易单的所有输出，包括找零
+func (decoder *TransactionDecoder) ValidateOutputs(outputs map[string]decimal.Decimal) error {
+
+	if len(outputs) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "Receiver addresses is empty!")
+	}
+
+	for addr, amount := range outputs {
+		if !amount.Shift(decoder.wm.Decimal()).Equal(amount.Shift(decoder.wm.Decimal()).Truncate(0)) {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "output amount: %s of %s has more than %d decimals", amount.String(), addr, decoder.wm.Decimal())
+		}
+
+		err := decoder.validateOutput(addr, amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//validateOutput 检查单个输出的地址和数量
+func (decoder *TransactionDecoder) validateOutput(address string, amount decimal.Decimal) error {
+
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "output amount: %s of %s must be greater than 0", amount.String(), address)
+	}
+
+	if amount.LessThan(decoder.wm.Config.DustLimit) {
+		return openwallet.Errorf(openwallet.ErrDustLimit, "output amount: %s of %s is less than dust limit: %s", amount.String(), address, decoder.wm.Config.DustLimit.String())
+	}
+
+	return decoder.ValidateAddress(address)
+}
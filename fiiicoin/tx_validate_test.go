@@ -0,0 +1,55 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package fiiicoin
+
+import (
+	"github.com/blocktree/openwallet/openwallet"
+	"testing"
+)
+
+func TestValidateReceivers(t *testing.T) {
+	decoder := NewTransactionDecoder(NewWalletManager())
+
+	tests := []struct {
+		to      map[string]string
+		errCode uint64
+	}{
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "0.12345678"}, 0},
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "0.123456789"}, openwallet.ErrCreateRawTransactionFailed},
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "0"}, openwallet.ErrCreateRawTransactionFailed},
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "-1"}, openwallet.ErrCreateRawTransactionFailed},
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "0.000001"}, openwallet.ErrDustLimit},
+		{map[string]string{"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXh": "1"}, openwallet.ErrAdressDecodeFailed},
+		{map[string]string{
+			"fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg":  "1",
+			" fiiimH1KXvvVxfuNAH97u3hzfFEmojvTdkJZXg": "1",
+		}, openwallet.ErrCreateRawTransactionFailed},
+	}
+
+	for i, test := range tests {
+		_, err := decoder.ValidateReceivers(test.to)
+		if test.errCode == 0 {
+			if err != nil {
+				t.Errorf("case[%d] failed unexpected error: %v", i, err)
+			}
+			continue
+		}
+		owErr := openwallet.ConvertError(err)
+		if owErr == nil || owErr.Code() != test.errCode {
+			t.Errorf("case[%d] error: %v, expected code: %d", i, err, test.errCode)
+		}
+	}
+}